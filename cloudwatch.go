@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// cacheNodeMetrics describes CloudWatch metrics collected for each node, in
+// the order they're queried
+var cacheNodeMetrics = [...]struct {
+	name string
+	stat string
+}{
+	{"BytesUsedForCache", cloudwatch.StatisticMaximum},
+	{"DatabaseMemoryUsagePercentage", cloudwatch.StatisticMaximum},
+	{"EngineCPUUtilization", cloudwatch.StatisticAverage},
+	{"NetworkBytesIn", cloudwatch.StatisticSum},
+	{"NetworkBytesOut", cloudwatch.StatisticSum},
+}
+
+// cloudwatchStats returns nodes memory stats based on CloudWatch metrics over
+// es.Window: used memory is es.Percentile of BytesUsedForCache, peak memory is
+// its maximum. Other metrics are set in Metrics of nodes.
+func (es *elasticacheSource) cloudwatchStats(ctx context.Context, svc *cloudwatch.CloudWatch, nodes []cacheNode) ([]sizing.RedisStats, error) {
+	end := time.Now().Truncate(time.Minute)
+	start := end.Add(-es.Window)
+	// keep the number of datapoints per metric reasonable, CloudWatch
+	// requires periods to be multiples of 60 seconds
+	period := int64(es.Window/time.Second) / 1440
+	period = (period + 59) / 60 * 60
+	if period < 60 {
+		period = 60
+	}
+	var queries []*cloudwatch.MetricDataQuery
+	for i, n := range nodes {
+		for j, m := range cacheNodeMetrics {
+			queries = append(queries, &cloudwatch.MetricDataQuery{
+				Id: aws.String(metricQueryID(i, j)),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String("AWS/ElastiCache"),
+						MetricName: aws.String(m.name),
+						Dimensions: []*cloudwatch.Dimension{
+							{Name: aws.String("CacheClusterId"), Value: aws.String(n.ClusterID)},
+							{Name: aws.String("CacheNodeId"), Value: aws.String(n.NodeID)},
+						},
+					},
+					Period: aws.Int64(period),
+					Stat:   aws.String(m.stat),
+				},
+			})
+		}
+	}
+	values := make(map[string][]float64, len(queries))
+	const maxQueries = 500 // GetMetricData limit
+	for len(queries) != 0 {
+		batch := queries
+		if len(batch) > maxQueries {
+			batch = batch[:maxQueries]
+		}
+		queries = queries[len(batch):]
+		var err error
+		err2 := svc.GetMetricDataPagesWithContext(ctx, &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: batch,
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(end),
+		}, func(res *cloudwatch.GetMetricDataOutput, _ bool) bool {
+			for _, r := range res.MetricDataResults {
+				if code := aws.StringValue(r.StatusCode); code == cloudwatch.StatusCodeInternalError {
+					err = fmt.Errorf("metric query %s: status %s", aws.StringValue(r.Id), code)
+					return false
+				}
+				id := aws.StringValue(r.Id)
+				values[id] = append(values[id], aws.Float64ValueSlice(r.Values)...)
+			}
+			return true
+		})
+		if err2 != nil {
+			return nil, err2
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := make([]sizing.RedisStats, len(nodes))
+	for i, n := range nodes {
+		id := func(j int) string { return metricQueryID(i, j) }
+		used := values[id(0)]
+		if len(used) == 0 {
+			return nil, fmt.Errorf("%s: no BytesUsedForCache datapoints over the last %v", n.Addr, es.Window)
+		}
+		pct := "p" + strconv.FormatFloat(es.Percentile, 'f', -1, 64)
+		st := sizing.RedisStats{
+			Addr:      n.Addr,
+			UsedBytes: uint64(percentile(used, es.Percentile)),
+			PeakBytes: uint64(percentile(used, 100)),
+		}
+		metrics := make(map[string]float64)
+		metrics["DatabaseMemoryUsagePercentage.max"] = percentile(values[id(1)], 100)
+		metrics["EngineCPUUtilization."+pct] = percentile(values[id(2)], es.Percentile)
+		cpuMax := percentile(values[id(2)], 100)
+		metrics["EngineCPUUtilization.max"] = cpuMax
+		perSecond := func(vals []float64) []float64 {
+			out := make([]float64, len(vals))
+			for i, v := range vals {
+				out[i] = v / float64(period)
+			}
+			return out
+		}
+		// network metrics are reported in bytes per second
+		for j, name := range map[int]string{3: "NetworkBytesIn", 4: "NetworkBytesOut"} {
+			vals := perSecond(values[id(j)])
+			metrics[name+"PerSecond."+pct] = percentile(vals, es.Percentile)
+			metrics[name+"PerSecond.max"] = percentile(vals, 100)
+		}
+		if cpuMax >= 90 {
+			log.Printf("%s: engine CPU utilization reached %.0f%% over the last %v,"+
+				" node with less memory may not keep up with the load", n.Addr, cpuMax, es.Window)
+		}
+		out[i] = st
+		nodes[i].Metrics = metrics
+	}
+	return out, nil
+}
+
+// writeCloudWatchJSON writes report as indented JSON like sizing.WriteJSON,
+// with additional top-level Metrics object of CloudWatch metrics keyed by
+// node address
+func writeCloudWatchJSON(w io.Writer, rep sizing.Report, metrics map[string]map[string]float64) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(struct {
+		sizing.Report
+		Metrics map[string]map[string]float64
+	}{rep, metrics})
+}
+
+// nodesMetrics returns metrics of nodes keyed by node address, or nil if
+// nodes have none
+func nodesMetrics(nodes []cacheNode) map[string]map[string]float64 {
+	var out map[string]map[string]float64
+	for _, n := range nodes {
+		if n.Metrics == nil {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]map[string]float64, len(nodes))
+		}
+		out[n.Addr] = n.Metrics
+	}
+	return out
+}
+
+// metricQueryID returns GetMetricData query id for i-th node and j-th metric
+// of cacheNodeMetrics
+func metricQueryID(i, j int) string { return "n" + strconv.Itoa(i) + "_" + strconv.Itoa(j) }
+
+// percentile returns p-th percentile of values using nearest-rank method,
+// p=100 returns the maximum. It returns 0 for empty values.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// fakeCloudWatch returns a server answering GetMetricData with values returned
+// by values for each query id, and a function returning the number of queries
+// in each request received so far
+func fakeCloudWatch(t *testing.T, values func(id string) []float64) (*httptest.Server, func() []int) {
+	t.Helper()
+	var mu sync.Mutex
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.FormValue("Action"); action != "GetMetricData" {
+			t.Errorf("unexpected action %q", action)
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		var results strings.Builder
+		n := 0
+		for ; ; n++ {
+			id := r.FormValue(fmt.Sprintf("MetricDataQueries.member.%d.Id", n+1))
+			if id == "" {
+				break
+			}
+			fmt.Fprintf(&results, "<member><Id>%s</Id><StatusCode>Complete</StatusCode><Values>", id)
+			for _, v := range values(id) {
+				fmt.Fprintf(&results, "<member>%g</member>", v)
+			}
+			results.WriteString("</Values></member>")
+		}
+		mu.Lock()
+		batches = append(batches, n)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<GetMetricDataResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">`+
+			`<GetMetricDataResult><MetricDataResults>%s</MetricDataResults></GetMetricDataResult></GetMetricDataResponse>`, results.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), batches...)
+	}
+}
+
+func TestCloudWatchStats(t *testing.T) {
+	// 101 nodes of 5 metrics each need two GetMetricData calls
+	nodes := make([]cacheNode, 101)
+	for i := range nodes {
+		nodes[i] = cacheNode{ClusterID: fmt.Sprintf("cache-%03d", i), NodeID: "0001", Addr: fmt.Sprintf("cache-%03d:6379", i)}
+	}
+	srv, batches := fakeCloudWatch(t, func(id string) []float64 {
+		var i, j int
+		if _, err := fmt.Sscanf(id, "n%d_%d", &i, &j); err != nil {
+			t.Errorf("unexpected query id %q", id)
+			return nil
+		}
+		if j != 0 && j != 3 {
+			return []float64{50}
+		}
+		// 1..20 in reverse order, scaled by node number
+		vals := make([]float64, 20)
+		for k := range vals {
+			vals[k] = float64((20 - k) * (i + 1))
+		}
+		if j == 0 {
+			for k := range vals {
+				vals[k] *= 1 << 20
+			}
+		}
+		return vals
+	})
+	es := elasticacheSource{Stats: "cloudwatch", Window: 24 * time.Hour, Percentile: 95}
+	svc := cloudwatch.New(testSession(t), aws.NewConfig().WithRegion("us-east-1").WithEndpoint(srv.URL))
+	stats, err := es.cloudwatchStats(context.Background(), svc, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := batches(), []int{500, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got GetMetricData calls of %v queries, want %v", got, want)
+	}
+	if len(stats) != len(nodes) {
+		t.Fatalf("got %d stats, want %d", len(stats), len(nodes))
+	}
+	for _, i := range []int{0, 100} {
+		st := stats[i]
+		scale := float64(i + 1)
+		if st.Addr != nodes[i].Addr {
+			t.Errorf("got stats of %s, want %s", st.Addr, nodes[i].Addr)
+		}
+		// nearest-rank 95th percentile of 20 values is the 19th one
+		if want := uint64(19*scale) << 20; st.UsedBytes != want {
+			t.Errorf("%s: got used %d bytes, want %d", st.Addr, st.UsedBytes, want)
+		}
+		if want := uint64(20*scale) << 20; st.PeakBytes != want {
+			t.Errorf("%s: got peak %d bytes, want %d", st.Addr, st.PeakBytes, want)
+		}
+		// 24h window is queried with 60s periods
+		if got, want := nodes[i].Metrics["NetworkBytesInPerSecond.max"], 20*scale/60; !approxEqual(got, want) {
+			t.Errorf("%s: got NetworkBytesInPerSecond.max %g, want %g", st.Addr, got, want)
+		}
+		if got := nodes[i].Metrics["EngineCPUUtilization.p95"]; got != 50 {
+			t.Errorf("%s: got EngineCPUUtilization.p95 %g, want 50", st.Addr, got)
+		}
+	}
+}
+
+func TestCloudWatchStatsNoData(t *testing.T) {
+	srv, _ := fakeCloudWatch(t, func(string) []float64 { return nil })
+	es := elasticacheSource{Stats: "cloudwatch", Window: 24 * time.Hour, Percentile: 95}
+	svc := cloudwatch.New(testSession(t), aws.NewConfig().WithRegion("us-east-1").WithEndpoint(srv.URL))
+	_, err := es.cloudwatchStats(context.Background(), svc, []cacheNode{{ClusterID: "cache", NodeID: "0001", Addr: "cache:6379"}})
+	if want := "cache:6379: no BytesUsedForCache datapoints over the last 24h0m0s"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{7, 1, 10, 3, 5, 9, 2, 8, 4, 6}
+	for _, tc := range []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 95, 0},
+		{[]float64{42}, 50, 42},
+		{values, 100, 10},
+		{values, 95, 10}, // rank 10 of 10
+		{values, 90, 9},
+		{values, 50, 5},
+		{values, 11, 2}, // rank rounds up
+		{values, 1, 1},
+	} {
+		if got := percentile(tc.values, tc.p); got != tc.want {
+			t.Errorf("percentile(%v, %g) = %g, want %g", tc.values, tc.p, got, tc.want)
+		}
+	}
+	if values[0] != 7 {
+		t.Error("percentile sorted values in place")
+	}
+}
+
+func TestWriteCloudWatchJSON(t *testing.T) {
+	rep := sizing.NewReport([]sizing.ReportRow{{Redis: sizing.RedisStats{Addr: "cache:6379"}}}, "")
+	nodes := []cacheNode{
+		{Addr: "cache:6379", Metrics: map[string]float64{"EngineCPUUtilization.max": 42}},
+		{Addr: "other:6379"},
+	}
+	buf := new(bytes.Buffer)
+	if err := writeCloudWatchJSON(buf, rep, nodesMetrics(nodes)); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		sizing.Report
+		Metrics map[string]map[string]float64
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rows) != 1 || got.Rows[0].Redis.Addr != "cache:6379" {
+		t.Errorf("got report rows %+v", got.Rows)
+	}
+	if want := map[string]map[string]float64{"cache:6379": {"EngineCPUUtilization.max": 42}}; !reflect.DeepEqual(got.Metrics, want) {
+		t.Errorf("got metrics %v, want %v", got.Metrics, want)
+	}
+	if m := nodesMetrics(nodes[1:]); m != nil {
+		t.Errorf("got metrics %v of nodes without them, want nil", m)
+	}
+}
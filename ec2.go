@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ec2Source discovers self-managed Redis instances running on EC2 instances
+// selected by tags.
+type ec2Source struct {
+	Tags    stringsFlag // key=value tag filters, all must match
+	PortTag string      // tag with comma-separated Redis ports on the instance
+	Port    int         // Redis port used if instance has no PortTag tag
+
+	Endpoint string // optional EC2 API endpoint, i.e. for a local stub
+}
+
+func (es *ec2Source) validate() error {
+	for _, t := range es.Tags {
+		if i := strings.IndexByte(t, '='); i < 1 {
+			return fmt.Errorf("EC2 tag filter %q must be in key=value format", t)
+		}
+	}
+	if es.Port < 1 || es.Port > 65535 {
+		return errors.New("EC2 Redis port must be in [1,65535] range")
+	}
+	return nil
+}
+
+// ec2Redis is a Redis instance found on EC2 instance
+type ec2Redis struct {
+	Addr   string
+	Labels map[string]string
+}
+
+// redises returns Redis addresses on private IPs of running EC2 instances
+// matching tag filters, sorted by address.
+func (es *ec2Source) redises(ctx context.Context, sess *session.Session, region string) ([]ec2Redis, error) {
+	filters := []*ec2.Filter{{
+		Name:   aws.String("instance-state-name"),
+		Values: aws.StringSlice([]string{ec2.InstanceStateNameRunning}),
+	}}
+	for _, t := range es.Tags {
+		i := strings.IndexByte(t, '=')
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + t[:i]),
+			Values: aws.StringSlice([]string{t[i+1:]}),
+		})
+	}
+	cfg := aws.NewConfig().WithRegion(region)
+	if es.Endpoint != "" {
+		cfg = cfg.WithEndpoint(es.Endpoint)
+	}
+	svc := ec2.New(sess, cfg)
+	var out []ec2Redis
+	var err error
+	err2 := svc.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{Filters: filters},
+		func(res *ec2.DescribeInstancesOutput, _ bool) bool {
+			for _, r := range res.Reservations {
+				for _, inst := range r.Instances {
+					id := aws.StringValue(inst.InstanceId)
+					ip := aws.StringValue(inst.PrivateIpAddress)
+					if ip == "" {
+						log.Printf("EC2 instance %s has no private IP address, skipping", id)
+						continue
+					}
+					ports := []string{strconv.Itoa(es.Port)}
+					for _, tag := range inst.Tags {
+						if aws.StringValue(tag.Key) == es.PortTag {
+							ports = strings.Split(aws.StringValue(tag.Value), ",")
+						}
+					}
+					seen := make(map[int]bool, len(ports))
+					for _, port := range ports {
+						port = strings.TrimSpace(port)
+						n, perr := strconv.Atoi(port)
+						if perr != nil || n < 1 || n > 65535 {
+							err = fmt.Errorf("EC2 instance %s: invalid port %q in %s tag", id, port, es.PortTag)
+							return false
+						}
+						// the same port listed twice is the same Redis
+						if seen[n] {
+							continue
+						}
+						seen[n] = true
+						port = strconv.Itoa(n)
+						out = append(out, ec2Redis{
+							Addr: net.JoinHostPort(ip, port),
+							Labels: map[string]string{
+								"ec2-instance-id":   id,
+								"ec2-instance-type": aws.StringValue(inst.InstanceType),
+							},
+						})
+					}
+				}
+			}
+			return true
+		})
+	if err2 != nil {
+		return nil, err2
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out, nil
+}
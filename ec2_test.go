@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEC2 returns a server answering DescribeInstances with instances XML,
+// checking that request filters match wantFilters
+func fakeEC2(t *testing.T, wantFilters map[string]string, instances string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.FormValue("Action"); action != "DescribeInstances" {
+			t.Errorf("unexpected action %q", action)
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		filters := make(map[string]string)
+		for i := 1; r.FormValue(fmt.Sprintf("Filter.%d.Name", i)) != ""; i++ {
+			filters[r.FormValue(fmt.Sprintf("Filter.%d.Name", i))] = r.FormValue(fmt.Sprintf("Filter.%d.Value.1", i))
+		}
+		if !reflect.DeepEqual(filters, wantFilters) {
+			t.Errorf("got filters %v, want %v", filters, wantFilters)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">`+
+			`<reservationSet><item><instancesSet>%s</instancesSet></item></reservationSet></DescribeInstancesResponse>`, instances)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testInstance(id, instanceType, ip, ports string) string {
+	var tags string
+	if ports != "" {
+		tags = "<tagSet><item><key>redis-port</key><value>" + ports + "</value></item></tagSet>"
+	}
+	return "<item><instanceId>" + id + "</instanceId><instanceType>" + instanceType + "</instanceType>" +
+		"<privateIpAddress>" + ip + "</privateIpAddress>" + tags + "</item>"
+}
+
+func TestEC2Redises(t *testing.T) {
+	wantFilters := map[string]string{"instance-state-name": "running", "tag:role": "redis", "tag:env": "prod"}
+	for _, tc := range []struct {
+		name      string
+		instances []string
+		want      []ec2Redis
+		err       string
+	}{
+		{
+			name: "port tag and default port",
+			instances: []string{
+				testInstance("i-2", "r5.large", "10.0.0.2", ""),
+				testInstance("i-1", "r5.xlarge", "10.0.0.1", "6380, 6379,6380"),
+				testInstance("i-3", "r5.large", "", "6379"),
+			},
+			want: []ec2Redis{
+				{Addr: "10.0.0.1:6379", Labels: map[string]string{"ec2-instance-id": "i-1", "ec2-instance-type": "r5.xlarge"}},
+				{Addr: "10.0.0.1:6380", Labels: map[string]string{"ec2-instance-id": "i-1", "ec2-instance-type": "r5.xlarge"}},
+				{Addr: "10.0.0.2:6379", Labels: map[string]string{"ec2-instance-id": "i-2", "ec2-instance-type": "r5.large"}},
+			},
+		},
+		{
+			name:      "invalid port",
+			instances: []string{testInstance("i-1", "r5.large", "10.0.0.1", "6379,redis")},
+			err:       `EC2 instance i-1: invalid port "redis" in redis-port tag`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakeEC2(t, wantFilters, strings.Join(tc.instances, ""))
+			es := ec2Source{Tags: stringsFlag{"role=redis", "env=prod"}, PortTag: "redis-port", Port: 6379, Endpoint: srv.URL}
+			got, err := es.redises(context.Background(), testSession(t), "us-east-1")
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got\n%+v\nwant\n%+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// elasticacheSource discovers ElastiCache for Redis nodes in a region and
+// collects their memory stats, either connecting to node endpoints, or
+// reading CloudWatch metrics.
+type elasticacheSource struct {
+	Stats     string // either "info" or "cloudwatch"
+	Endpoint  string // optional ElastiCache API endpoint, i.e. for a local stub
+	AuthToken string // AUTH token for "info" stats of clusters with AUTH enabled
+
+	Window             time.Duration // CloudWatch metrics time window
+	Percentile         float64       // CloudWatch metrics percentile used as used memory
+	CloudWatchEndpoint string        // optional CloudWatch API endpoint
+}
+
+func (es *elasticacheSource) validate() error {
+	switch es.Stats {
+	case "info":
+		return nil
+	case "cloudwatch":
+		if es.Window < time.Hour {
+			return errors.New("CloudWatch metrics window must be at least one hour")
+		}
+		if es.Percentile <= 0 || es.Percentile > 100 {
+			return errors.New("CloudWatch metrics percentile must be in (0,100] range")
+		}
+		return nil
+	}
+	return errors.New("ElastiCache stats source must be either info or cloudwatch")
+}
+
+// cacheNode is a single ElastiCache node
+type cacheNode struct {
+	ClusterID string
+	NodeID    string
+	NodeType  string
+	Engine    string // either redis or valkey
+	Addr      string // HOST:PORT
+	Labels    map[string]string
+
+	TLS  bool // in-transit encryption enabled
+	Auth bool // AUTH token required
+
+	// CloudWatch metrics by name, only set with cloudwatch stats; not used
+	// for matching
+	Metrics map[string]float64
+}
+
+// stats returns memory stats of all Redis nodes in a region along with the
+// nodes themselves, in the same order. Each returned RedisStats has its
+// NodeType set to the current node type.
+func (es *elasticacheSource) stats(ctx context.Context, sess *session.Session, region string) ([]sizing.RedisStats, []cacheNode, error) {
+	cfg := aws.NewConfig().WithRegion(region)
+	if es.Endpoint != "" {
+		cfg = cfg.WithEndpoint(es.Endpoint)
+	}
+	nodes, err := es.nodes(ctx, elasticache.New(sess, cfg))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("no ElastiCache for Redis nodes found in %s region", region)
+	}
+	var out []sizing.RedisStats
+	switch es.Stats {
+	case "info":
+		endpoints := make([]sizing.Endpoint, len(nodes))
+		for i, n := range nodes {
+			if n.Auth && es.AuthToken == "" {
+				return nil, nil, fmt.Errorf("ElastiCache cluster %s has AUTH enabled, set %s environment variable"+
+					" or use cloudwatch stats", n.ClusterID, authTokenEnv)
+			}
+			endpoints[i] = sizing.Endpoint{Addr: n.Addr, TLS: n.TLS}
+			if n.Auth {
+				endpoints[i].Password = es.AuthToken
+			}
+		}
+		if out, err = sizing.EndpointStats(ctx, endpoints, nil); err != nil {
+			return nil, nil, err
+		}
+	case "cloudwatch":
+		cfg := aws.NewConfig().WithRegion(region)
+		if es.CloudWatchEndpoint != "" {
+			cfg = cfg.WithEndpoint(es.CloudWatchEndpoint)
+		}
+		if out, err = es.cloudwatchStats(ctx, cloudwatch.New(sess, cfg), nodes); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i, n := range nodes {
+		out[i].NodeType = n.NodeType
+		out[i].Labels = n.Labels
+	}
+	return out, nodes, nil
+}
+
+// authTokenEnv is the environment variable with AUTH token used to connect to
+// ElastiCache clusters with AUTH enabled
+const authTokenEnv = "ELASTICACHE_AUTH_TOKEN"
+
+// nodes returns all Redis nodes with endpoints available, sorted by their
+// cluster and node ids.
+func (es *elasticacheSource) nodes(ctx context.Context, svc *elasticache.ElastiCache) ([]cacheNode, error) {
+	roles := make(map[[2]string]string) // cluster and node ids to node role
+	err := svc.DescribeReplicationGroupsPagesWithContext(ctx, &elasticache.DescribeReplicationGroupsInput{},
+		func(res *elasticache.DescribeReplicationGroupsOutput, _ bool) bool {
+			for _, rg := range res.ReplicationGroups {
+				for _, ng := range rg.NodeGroups {
+					for _, m := range ng.NodeGroupMembers {
+						key := [2]string{aws.StringValue(m.CacheClusterId), aws.StringValue(m.CacheNodeId)}
+						roles[key] = aws.StringValue(m.CurrentRole)
+					}
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	var out []cacheNode
+	err = svc.DescribeCacheClustersPagesWithContext(ctx, &elasticache.DescribeCacheClustersInput{
+		ShowCacheNodeInfo: aws.Bool(true),
+	}, func(res *elasticache.DescribeCacheClustersOutput, _ bool) bool {
+		for _, cc := range res.CacheClusters {
+			switch aws.StringValue(cc.Engine) {
+			case "redis", "valkey":
+			default:
+				continue
+			}
+			for _, cn := range cc.CacheNodes {
+				n := cacheNode{
+					ClusterID: aws.StringValue(cc.CacheClusterId),
+					NodeID:    aws.StringValue(cn.CacheNodeId),
+					NodeType:  aws.StringValue(cc.CacheNodeType),
+					Engine:    aws.StringValue(cc.Engine),
+					TLS:       aws.BoolValue(cc.TransitEncryptionEnabled),
+					Auth:      aws.BoolValue(cc.AuthTokenEnabled),
+					Labels: map[string]string{
+						"elasticache-cluster": aws.StringValue(cc.CacheClusterId),
+					},
+				}
+				if cn.Endpoint == nil || aws.StringValue(cn.Endpoint.Address) == "" {
+					log.Printf("ElastiCache cluster %s node %s has no endpoint yet, skipping", n.ClusterID, n.NodeID)
+					continue
+				}
+				n.Addr = net.JoinHostPort(aws.StringValue(cn.Endpoint.Address),
+					strconv.FormatInt(aws.Int64Value(cn.Endpoint.Port), 10))
+				if rg := aws.StringValue(cc.ReplicationGroupId); rg != "" {
+					n.Labels["elasticache-replication-group"] = rg
+				}
+				if role := roles[[2]string{n.ClusterID, n.NodeID}]; role != "" {
+					n.Labels["elasticache-role"] = role
+				}
+				out = append(out, n)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ClusterID == out[j].ClusterID {
+			return out[i].NodeID < out[j].NodeID
+		}
+		return out[i].ClusterID < out[j].ClusterID
+	})
+	return out, nil
+}
+
+// currentOfferings returns offerings for node types of nodes, keyed by node
+// address. Offerings are for the engine of each node's cluster and are not
+// limited by instance family or generation.
+func currentOfferings(ctx context.Context, prices sizing.Provider, location string, nodes []cacheNode, resMemPct int) (map[string]sizing.Offering, error) {
+	byType := make(map[[2]string]sizing.Offering) // engine and node type to offering
+	out := make(map[string]sizing.Offering, len(nodes))
+	for _, n := range nodes {
+		key := [2]string{n.Engine, n.NodeType}
+		if o, ok := byType[key]; ok {
+			out[n.Addr] = o
+			continue
+		}
+		ofs, err := fetchOfferings(ctx, prices, sizing.OfferingsQuery{
+			Location:              location,
+			InstanceType:          n.NodeType,
+			Engine:                n.Engine,
+			AnyFamily:             true,
+			AnyGeneration:         true,
+			ReservedMemoryPercent: resMemPct,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(ofs) == 0 {
+			return nil, fmt.Errorf("no %s price found for node type %q in %s", n.Engine, n.NodeType, location)
+		}
+		byType[key] = ofs[0]
+		out[n.Addr] = ofs[0]
+	}
+	return out, nil
+}
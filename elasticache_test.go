@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// fakeElastiCache returns a server answering ElastiCache Query API actions
+// with canned XML responses keyed by action name
+func fakeElastiCache(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.FormValue("Action")
+		body, ok := responses[action]
+		if !ok {
+			t.Errorf("unexpected action %q", action)
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<%[1]sResponse xmlns="http://elasticache.amazonaws.com/doc/2015-02-02/">`+
+			`<%[1]sResult>%[2]s</%[1]sResult></%[1]sResponse>`, action, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testSession(t *testing.T) *session.Session {
+	t.Helper()
+	sess, err := session.NewSession(aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithMaxRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+const testReplicationGroups = `<ReplicationGroups><ReplicationGroup>
+	<ReplicationGroupId>cache</ReplicationGroupId>
+	<NodeGroups><NodeGroup><NodeGroupMembers>
+		<NodeGroupMember><CacheClusterId>cache-001</CacheClusterId><CacheNodeId>0001</CacheNodeId><CurrentRole>primary</CurrentRole></NodeGroupMember>
+		<NodeGroupMember><CacheClusterId>cache-002</CacheClusterId><CacheNodeId>0001</CacheNodeId><CurrentRole>replica</CurrentRole></NodeGroupMember>
+	</NodeGroupMembers></NodeGroup></NodeGroups>
+</ReplicationGroup></ReplicationGroups>`
+
+const testCacheClusters = `<CacheClusters>
+<CacheCluster>
+	<CacheClusterId>sessions</CacheClusterId><Engine>valkey</Engine><CacheNodeType>cache.r5.large</CacheNodeType>
+	<AuthTokenEnabled>true</AuthTokenEnabled>
+	<CacheNodes><CacheNode><CacheNodeId>0001</CacheNodeId>
+		<Endpoint><Address>sessions.example.com</Address><Port>6380</Port></Endpoint>
+	</CacheNode></CacheNodes>
+</CacheCluster>
+<CacheCluster>
+	<CacheClusterId>cache-002</CacheClusterId><Engine>redis</Engine><CacheNodeType>cache.r5.large</CacheNodeType>
+	<ReplicationGroupId>cache</ReplicationGroupId><TransitEncryptionEnabled>true</TransitEncryptionEnabled>
+	<CacheNodes><CacheNode><CacheNodeId>0001</CacheNodeId>
+		<Endpoint><Address>cache-002.example.com</Address><Port>6379</Port></Endpoint>
+	</CacheNode></CacheNodes>
+</CacheCluster>
+<CacheCluster>
+	<CacheClusterId>cache-001</CacheClusterId><Engine>redis</Engine><CacheNodeType>cache.r5.large</CacheNodeType>
+	<ReplicationGroupId>cache</ReplicationGroupId><TransitEncryptionEnabled>true</TransitEncryptionEnabled>
+	<CacheNodes><CacheNode><CacheNodeId>0001</CacheNodeId>
+		<Endpoint><Address>cache-001.example.com</Address><Port>6379</Port></Endpoint>
+	</CacheNode></CacheNodes>
+</CacheCluster>
+<CacheCluster>
+	<CacheClusterId>creating</CacheClusterId><Engine>redis</Engine><CacheNodeType>cache.m5.large</CacheNodeType>
+	<CacheNodes><CacheNode><CacheNodeId>0001</CacheNodeId></CacheNode></CacheNodes>
+</CacheCluster>
+<CacheCluster>
+	<CacheClusterId>memcached</CacheClusterId><Engine>memcached</Engine><CacheNodeType>cache.m5.large</CacheNodeType>
+	<CacheNodes><CacheNode><CacheNodeId>0001</CacheNodeId>
+		<Endpoint><Address>memcached.example.com</Address><Port>11211</Port></Endpoint>
+	</CacheNode></CacheNodes>
+</CacheCluster>
+</CacheClusters>`
+
+func TestElastiCacheNodes(t *testing.T) {
+	srv := fakeElastiCache(t, map[string]string{
+		"DescribeReplicationGroups": testReplicationGroups,
+		"DescribeCacheClusters":     testCacheClusters,
+	})
+	es := elasticacheSource{Stats: "info", Endpoint: srv.URL}
+	svc := elasticache.New(testSession(t), aws.NewConfig().WithRegion("us-east-1").WithEndpoint(srv.URL))
+	got, err := es.nodes(context.Background(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cacheNode{
+		{
+			ClusterID: "cache-001", NodeID: "0001", NodeType: "cache.r5.large", Engine: "redis",
+			Addr: "cache-001.example.com:6379", TLS: true,
+			Labels: map[string]string{
+				"elasticache-cluster":           "cache-001",
+				"elasticache-replication-group": "cache",
+				"elasticache-role":              "primary",
+			},
+		},
+		{
+			ClusterID: "cache-002", NodeID: "0001", NodeType: "cache.r5.large", Engine: "redis",
+			Addr: "cache-002.example.com:6379", TLS: true,
+			Labels: map[string]string{
+				"elasticache-cluster":           "cache-002",
+				"elasticache-replication-group": "cache",
+				"elasticache-role":              "replica",
+			},
+		},
+		{
+			ClusterID: "sessions", NodeID: "0001", NodeType: "cache.r5.large", Engine: "valkey",
+			Addr: "sessions.example.com:6380", Auth: true,
+			Labels: map[string]string{"elasticache-cluster": "sessions"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got nodes\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestElastiCacheAuthToken(t *testing.T) {
+	srv := fakeElastiCache(t, map[string]string{
+		"DescribeReplicationGroups": testReplicationGroups,
+		"DescribeCacheClusters":     testCacheClusters,
+	})
+	es := elasticacheSource{Stats: "info", Endpoint: srv.URL}
+	_, _, err := es.stats(context.Background(), testSession(t), "us-east-1")
+	if want := "ElastiCache cluster sessions has AUTH enabled, set " + authTokenEnv +
+		" environment variable or use cloudwatch stats"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// testProduct returns AWS price list product of ElastiCache node type with
+// on-demand hourly price
+func testProduct(engine, location, instanceType, memory, family string, currentGen bool, price string) aws.JSONValue {
+	gen := "no"
+	if currentGen {
+		gen = "yes"
+	}
+	sku := engine + "/" + location + "/" + instanceType
+	return aws.JSONValue{
+		"product": map[string]interface{}{
+			"sku": sku,
+			"attributes": map[string]interface{}{
+				"cacheEngine":       engine,
+				"location":          location,
+				"instanceType":      instanceType,
+				"memory":            memory,
+				"instanceFamily":    family,
+				"currentGeneration": gen,
+			},
+		},
+		"terms": map[string]interface{}{
+			"OnDemand": map[string]interface{}{
+				sku + ".od": map[string]interface{}{
+					"priceDimensions": map[string]interface{}{
+						sku + ".od.hrs": map[string]interface{}{
+							"unit":         "Hrs",
+							"pricePerUnit": map[string]interface{}{"USD": price},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testSnapshot() *sizing.Snapshot {
+	return &sizing.Snapshot{PriceList: []aws.JSONValue{
+		testProduct("Redis", testLocation, "cache.m5.large", "6.38 GiB", "Standard", true, "0.156"),
+		testProduct("Redis", testLocation, "cache.r5.large", "13.07 GiB", "Memory optimized", true, "0.216"),
+		testProduct("Redis", testLocation, "cache.r5.xlarge", "26.32 GiB", "Memory optimized", true, "0.431"),
+		testProduct("Redis", testLocation, "cache.r4.large", "12.3 GiB", "Memory optimized", false, "0.228"),
+		testProduct("Valkey", testLocation, "cache.r5.large", "13.07 GiB", "Memory optimized", true, "0.173"),
+		testProduct("Valkey", testLocation, "cache.r5.xlarge", "26.32 GiB", "Memory optimized", true, "0.345"),
+	}}
+}
+
+func TestCurrentOfferingsSavings(t *testing.T) {
+	ctx := context.Background()
+	prices := testSnapshot()
+	nodes := []cacheNode{
+		{ClusterID: "cache-001", NodeType: "cache.r5.xlarge", Engine: "redis", Addr: "cache-001:6379"},
+		{ClusterID: "cache-002", NodeType: "cache.r5.xlarge", Engine: "redis", Addr: "cache-002:6379"},
+		{ClusterID: "sessions", NodeType: "cache.r5.xlarge", Engine: "valkey", Addr: "sessions:6379"},
+	}
+	current, err := currentOfferings(ctx, prices, testLocation, nodes, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]float64{"cache-001:6379": 0.431, "cache-002:6379": 0.431, "sessions:6379": 0.345} {
+		if got := current[addr].PricePerHour; got != want {
+			t.Errorf("%s: got current price %v, want %v", addr, got, want)
+		}
+	}
+
+	args := newRunArgs()
+	key := offeringsKey{Engine: sizing.DefaultEngine, ResMemPct: args.resMemPct}
+	ofs, err := sizing.FetchOfferings(ctx, prices, args.query(key, testLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gib = 1 << 30
+	stats := []sizing.RedisStats{
+		{Addr: "cache-001:6379", UsedBytes: 2 * gib, PeakBytes: 3 * gib, NodeType: "cache.r5.xlarge"},
+		{Addr: "sessions:6379", UsedBytes: 2 * gib, PeakBytes: 12 * gib, NodeType: "cache.r5.xlarge"},
+	}
+	rep, err := args.report(stats, nil, map[offeringsKey]sizing.Offerings{key: ofs}, current, testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		used, peak               string
+		usedSavings, peakSavings float64
+	}{
+		{"cache.r5.large", "cache.r5.large", (0.431 - 0.216) * sizing.HoursPerMonth, (0.431 - 0.216) * sizing.HoursPerMonth},
+		{"cache.r5.large", "cache.r5.xlarge", (0.345 - 0.216) * sizing.HoursPerMonth, (0.345 - 0.431) * sizing.HoursPerMonth},
+	} {
+		row := rep.Rows[i]
+		if row.UsedBased.InstanceType != tc.used || row.PeakBased.InstanceType != tc.peak {
+			t.Errorf("%s: got %s/%s, want %s/%s", row.Redis.Addr,
+				row.UsedBased.InstanceType, row.PeakBased.InstanceType, tc.used, tc.peak)
+		}
+		if !approxEqual(row.UsedSavings(), tc.usedSavings) || !approxEqual(row.PeakSavings(), tc.peakSavings) {
+			t.Errorf("%s: got savings %.2f/%.2f, want %.2f/%.2f", row.Redis.Addr,
+				row.UsedSavings(), row.PeakSavings(), tc.usedSavings, tc.peakSavings)
+		}
+	}
+	if want := (0.431 + 0.345) * sizing.HoursPerMonth; !approxEqual(rep.CurrentTotal, want) {
+		t.Errorf("got current total %.2f, want %.2f", rep.CurrentTotal, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// fitsMain matches offerings to memory sizes given as arguments, without
+// connecting to any Redis
+func fitsMain(argv []string) error {
+	args := newRunArgs()
+	var engine string
+	fs := flag.NewFlagSet("fits", flag.ExitOnError)
+	args.sizingFlags(fs)
+	args.pricingFlags(fs)
+	args.outputFlags(fs)
+	fs.StringVar(&engine, "engine", sizing.DefaultEngine, "`engine` to use prices for: redis or valkey")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s fits [flags] SIZE[/PEAK]...\n\n", progName())
+		fmt.Fprint(fs.Output(), fitsNote)
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no sizes to match")
+	}
+	if err := args.validateOutput(); err != nil {
+		return err
+	}
+	if err := args.validateSizing(); err != nil {
+		return err
+	}
+	if err := (hostOverrides{Engine: engine}).validate(); err != nil {
+		return err
+	}
+	args.engine = strings.ToLower(engine)
+	region, ok := endpoints.AwsPartition().Regions()[args.region]
+	if !ok {
+		return fmt.Errorf("unsupported region %q", args.region)
+	}
+
+	stats := make([]sizing.RedisStats, fs.NArg())
+	for i, arg := range fs.Args() {
+		used, peak, err := parseSizes(arg)
+		if err != nil {
+			return err
+		}
+		stats[i] = sizing.RedisStats{Addr: arg, UsedBytes: used, PeakBytes: peak}
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	prices, err := args.pricingProvider(sess)
+	if err != nil {
+		return err
+	}
+	_, key := hostOverrides{}.effective(args)
+	ofs, err := fetchOfferings(context.Background(), prices, args.query(key, region.Description()))
+	if err != nil {
+		return err
+	}
+	rep, err := args.report(stats, nil, map[offeringsKey]sizing.Offerings{key: ofs}, nil, region.Description())
+	if err != nil {
+		return err
+	}
+	return args.writeReport(rep, ofs, nil)
+}
+
+// parseSizes parses either a single size used as both used and peak memory,
+// or a pair of used and peak sizes separated by slash, i.e. 12GiB/16GiB
+func parseSizes(s string) (used, peak uint64, err error) {
+	i := strings.IndexByte(s, '/')
+	if i == -1 {
+		used, err = parseSize(s)
+		return used, used, err
+	}
+	if used, err = parseSize(s[:i]); err != nil {
+		return 0, 0, err
+	}
+	if peak, err = parseSize(s[i+1:]); err != nil {
+		return 0, 0, err
+	}
+	if peak < used {
+		return 0, 0, fmt.Errorf("peak size cannot be less than used size in %q", s)
+	}
+	return used, peak, nil
+}
+
+const fitsNote = `Matches node types to memory sizes of planned Redis instances, without
+connecting to any Redis. Each SIZE is used as both used and peak memory, use
+USED/PEAK form, i.e. 12GiB/16GiB, to match them separately. Sizes are either
+in decimal (KB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB) units, or in bytes
+if unit is omitted.
+
+`
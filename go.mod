@@ -9,4 +9,5 @@ require (
 	github.com/kr/pretty v0.2.0 // indirect
 	golang.org/x/net v0.0.0-20200707034311-ab3426394381
 	golang.org/x/sync v0.0.0-20200317015054-43a5402ce75a
+	gopkg.in/yaml.v2 v2.2.7
 )
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// readInfoDumps reads Redis memory stats from saved INFO outputs, one file per
+// Redis instance. Path may either be a directory, or a .tar, .tar.gz, .tgz or
+// .zip archive. File names, with optional .txt or .info extensions removed,
+// are used as Redis addresses in the report. Files with names starting with
+// a dot are ignored, and archive files in subdirectories are rejected, as their
+// names would make ambiguous addresses.
+//
+// Such dumps can be collected with something like:
+//
+//	redis-cli -h $HOST -p $PORT INFO > $HOST:$PORT.txt
+//
+// Only memory section is required, but stats section is needed to detect
+// evicting caches.
+func readInfoDumps(name string) ([]sizing.RedisStats, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return readInfoDumpsDir(name)
+	}
+	switch lname := strings.ToLower(name); {
+	case strings.HasSuffix(lname, ".tar"):
+		return readInfoDumpsTar(name, false)
+	case strings.HasSuffix(lname, ".tar.gz"), strings.HasSuffix(lname, ".tgz"):
+		return readInfoDumpsTar(name, true)
+	case strings.HasSuffix(lname, ".zip"):
+		return readInfoDumpsZip(name)
+	}
+	return nil, fmt.Errorf("%s: unsupported INFO dumps location, must be a directory, or a .tar, .tar.gz, .tgz, .zip archive", name)
+}
+
+func readInfoDumpsDir(dir string) ([]sizing.RedisStats, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []sizing.RedisStats
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || skipInfoDump(fi.Name()) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		st, err := infoDumpStats(fi.Name(), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+func readInfoDumpsTar(name string, gzipped bool) ([]sizing.RedisStats, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rd io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		rd = gz
+	}
+	var out []sizing.RedisStats
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || skipInfoDump(hdr.Name) {
+			continue
+		}
+		st, err := infoDumpStats(hdr.Name, tr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+}
+
+func readInfoDumpsZip(name string) ([]sizing.RedisStats, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var out []sizing.RedisStats
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() || skipInfoDump(zf.Name) {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		st, err := infoDumpStats(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// skipInfoDump reports whether file with a given name, as found in directory
+// or archive, should be ignored.
+func skipInfoDump(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".")
+}
+
+// infoDumpStats parses INFO output read from rd; name is the name of the file
+// the output was saved to, which is used to derive Redis address.
+func infoDumpStats(name string, rd io.Reader) (sizing.RedisStats, error) {
+	addr := strings.TrimPrefix(name, "./")
+	if strings.Contains(addr, "/") {
+		return sizing.RedisStats{}, fmt.Errorf("%s: INFO dumps in subdirectories are not supported, archive them without a directory", name)
+	}
+	for _, ext := range [...]string{".txt", ".info"} {
+		if strings.HasSuffix(addr, ext) && len(addr) > len(ext) {
+			addr = strings.TrimSuffix(addr, ext)
+			break
+		}
+	}
+	st, err := sizing.ParseInfo(rd)
+	if err != nil {
+		return sizing.RedisStats{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if st.UsedBytes == 0 || st.PeakBytes == 0 {
+		return sizing.RedisStats{}, fmt.Errorf("%s: no used_memory or used_memory_peak values found, is this a Redis INFO output?", name)
+	}
+	st.Addr = addr
+	return st, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testInfoDump = "# Memory\r\nused_memory:1073741824\r\nused_memory_peak:2147483648\r\nmaxmemory:0\r\n"
+
+// archiveFile is a file to put into archive built by writeInfoArchive
+type archiveFile struct {
+	name, body string
+}
+
+// writeInfoArchive builds .tar, .tgz or .zip archive of files in memory,
+// picking the format by name extension, and writes it to a temporary
+// directory. It returns the archive path.
+func writeInfoArchive(t *testing.T, name string, files []archiveFile) string {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if strings.HasSuffix(name, ".zip") {
+		zw := zip.NewWriter(buf)
+		for _, f := range files {
+			w, err := zw.Create(f.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(f.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		var gz *gzip.Writer
+		tw := tar.NewWriter(buf)
+		if strings.HasSuffix(name, ".tgz") {
+			gz = gzip.NewWriter(buf)
+			tw = tar.NewWriter(gz)
+		}
+		for _, f := range files {
+			hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+			if strings.HasSuffix(f.name, "/") {
+				hdr = &tar.Header{Name: f.name, Mode: 0755, Typeflag: tar.TypeDir}
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(f.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadInfoDumpsArchives(t *testing.T) {
+	for _, name := range []string{"dumps.tar", "dumps.tgz", "dumps.zip"} {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				name  string
+				files []archiveFile
+				want  []string // addresses
+				err   string
+			}{
+				{
+					name: "addresses from file names",
+					files: []archiveFile{
+						{name: "./"},
+						{name: "redis-1:6379.txt", body: testInfoDump},
+						{name: "./redis-2:6379.info", body: testInfoDump},
+						{name: "redis-3", body: testInfoDump},
+						{name: ".DS_Store", body: "not an INFO output"},
+					},
+					want: []string{"redis-1:6379", "redis-2:6379", "redis-3"},
+				},
+				{
+					name: "nested path",
+					files: []archiveFile{
+						{name: "dumps/redis-1:6379.txt", body: testInfoDump},
+					},
+					err: "dumps/redis-1:6379.txt: INFO dumps in subdirectories are not supported",
+				},
+				{
+					name: "not INFO output",
+					files: []archiveFile{
+						{name: "redis-1:6379.txt", body: testInfoDump},
+						{name: "README", body: "INFO dumps of production Redis\n"},
+					},
+					err: "README: no used_memory or used_memory_peak values found",
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					stats, err := readInfoDumps(writeInfoArchive(t, name, tc.files))
+					if tc.err != "" {
+						if err == nil || !strings.Contains(err.Error(), tc.err) {
+							t.Errorf("got error %v, want one containing %q", err, tc.err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					var got []string
+					for _, st := range stats {
+						got = append(got, st.Addr)
+						if st.UsedBytes != 1<<30 || st.PeakBytes != 2<<30 {
+							t.Errorf("%s: got used %d, peak %d bytes", st.Addr, st.UsedBytes, st.PeakBytes)
+						}
+					}
+					if !reflect.DeepEqual(got, tc.want) {
+						t.Errorf("got addresses %q, want %q", got, tc.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestReadInfoDumpsUnsupported(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dumps.rar")
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readInfoDumps(name); err == nil || !strings.Contains(err.Error(), "unsupported INFO dumps location") {
+		t.Errorf("got error %v, want unsupported location error", err)
+	}
+}
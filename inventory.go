@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"gopkg.in/yaml.v2"
+)
+
+// inventoryEntry is a single Redis in inventory file
+type inventoryEntry struct {
+	Addr             string            `yaml:"addr"`
+	Labels           map[string]string `yaml:"labels"`
+	Nodes            int               `yaml:"nodes"` // number of nodes, i.e. primary and replicas, 1 if unset
+	redisCredentials `yaml:",inline"`
+	hostOverrides    `yaml:",inline"`
+}
+
+// redisCredentials are used to connect to Redis in inventory. Password is never
+// stored in inventory itself, but read from an environment variable or file.
+type redisCredentials struct {
+	Username     string `yaml:"username"`
+	PasswordEnv  string `yaml:"password-env"`  // name of environment variable with password
+	PasswordFile string `yaml:"password-file"` // name of file with password
+	TLS          bool   `yaml:"tls"`
+}
+
+// endpoint returns endpoint to connect to Redis at addr with credentials
+func (c redisCredentials) endpoint(addr string) (sizing.Endpoint, error) {
+	ep := sizing.Endpoint{Addr: addr, Username: c.Username, TLS: c.TLS}
+	switch {
+	case c.PasswordEnv != "":
+		var ok bool
+		if ep.Password, ok = os.LookupEnv(c.PasswordEnv); !ok {
+			return sizing.Endpoint{}, fmt.Errorf("%s: password environment variable %s is not set", addr, c.PasswordEnv)
+		}
+	case c.PasswordFile != "":
+		b, err := ioutil.ReadFile(c.PasswordFile)
+		if err != nil {
+			return sizing.Endpoint{}, fmt.Errorf("%s: reading password: %w", addr, err)
+		}
+		ep.Password = strings.TrimRight(string(b), "\r\n")
+	}
+	return ep, nil
+}
+
+// hostOverrides are per-Redis values of corresponding command line flags,
+// unset fields mean flag values are used
+type hostOverrides struct {
+	MaxLoad               *int   `yaml:"max-load" json:",omitempty"`
+	ReservedMemoryPercent *int   `yaml:"reserved-memory-percent" json:",omitempty"`
+	Engine                string `yaml:"engine" json:",omitempty"` // one of sizing.Engines keys
+}
+
+// effective returns values to use for the Redis, taking defaults from args
+// for values not overridden
+func (o hostOverrides) effective(args runArgs) (maxLoadPct int, key offeringsKey) {
+	maxLoadPct, key = args.maxLoadPct, offeringsKey{Engine: args.engine, ResMemPct: args.resMemPct}
+	if o.MaxLoad != nil {
+		maxLoadPct = *o.MaxLoad
+	}
+	if o.ReservedMemoryPercent != nil {
+		key.ResMemPct = *o.ReservedMemoryPercent
+	}
+	if o.Engine != "" {
+		key.Engine = strings.ToLower(o.Engine)
+	}
+	return maxLoadPct, key
+}
+
+// set sets override from key=value pair, as used in address file
+func (o *hostOverrides) set(kv string) error {
+	i := strings.IndexByte(kv, '=')
+	if i < 1 {
+		return fmt.Errorf("override %q must be in key=value format", kv)
+	}
+	key, value := kv[:i], kv[i+1:]
+	switch key {
+	case "max-load", "reserved-memory-percent":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q", key, value)
+		}
+		if key == "max-load" {
+			o.MaxLoad = &n
+		} else {
+			o.ReservedMemoryPercent = &n
+		}
+	case "engine":
+		o.Engine = value
+	default:
+		return fmt.Errorf("unsupported override %q, must be one of max-load, reserved-memory-percent, engine", key)
+	}
+	return o.validate()
+}
+
+func (o hostOverrides) validate() error {
+	if o.MaxLoad != nil && (*o.MaxLoad < 1 || *o.MaxLoad > 100) {
+		return errors.New("max-load must be in [1,100] percent range")
+	}
+	if o.ReservedMemoryPercent != nil && (*o.ReservedMemoryPercent < 0 || *o.ReservedMemoryPercent > 100) {
+		return errors.New("reserved-memory-percent must be in [0,100] range")
+	}
+	if _, ok := sizing.Engines[strings.ToLower(o.Engine)]; o.Engine != "" && !ok {
+		return fmt.Errorf("unsupported engine %q, must be either redis or valkey", o.Engine)
+	}
+	return nil
+}
+
+// offeringsKey identifies set of offerings fetched for a given engine and
+// with memory corrected to a given reserved-memory-percent value
+type offeringsKey struct {
+	Engine    string
+	ResMemPct int
+}
+
+// readInventory reads YAML or JSON inventory file of the following form:
+//
+//	redises:
+//	  - addr: redis-1.example.com:6379
+//	    labels:
+//	      owner: team-a
+//	      env: prod
+//	    max-load: 60
+//	    reserved-memory-percent: 50
+//	    engine: valkey
+//	    nodes: 3
+//	    username: app
+//	    password-env: REDIS_1_PASSWORD
+//	    tls: true
+//
+// Only addr is required. Costs of Redis with more than one node, i.e. primary
+// and replicas, are multiplied by the number of nodes. Password is read from
+// either password-env environment variable or password-file file.
+func readInventory(name string) ([]inventoryEntry, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseInventory(b, name)
+}
+
+// parseInventory parses inventory in readInventory format, name is used in
+// error messages
+func parseInventory(b []byte, name string) ([]inventoryEntry, error) {
+	var inv struct {
+		Redises []inventoryEntry `yaml:"redises"`
+	}
+	// JSON is a subset of YAML, so this handles both
+	if err := yaml.UnmarshalStrict(b, &inv); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	seen := make(map[string]struct{}, len(inv.Redises))
+	for i, e := range inv.Redises {
+		if e.Addr == "" {
+			return nil, fmt.Errorf("%s: entry #%d has no addr", name, i+1)
+		}
+		if host, port, err := net.SplitHostPort(e.Addr); err != nil || host == "" || port == "" {
+			return nil, fmt.Errorf("%s: %q does not look like a valid address in HOST:PORT format", name, e.Addr)
+		}
+		if _, ok := seen[e.Addr]; ok {
+			return nil, fmt.Errorf("%s: duplicate address %q", name, e.Addr)
+		}
+		seen[e.Addr] = struct{}{}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", name, e.Addr, err)
+		}
+		if e.Nodes < 0 {
+			return nil, fmt.Errorf("%s: %s: nodes must not be negative", name, e.Addr)
+		}
+		if e.PasswordEnv != "" && e.PasswordFile != "" {
+			return nil, fmt.Errorf("%s: %s: only one of password-env and password-file can be set", name, e.Addr)
+		}
+	}
+	return inv.Redises, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+func TestParseInventory(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, err string
+	}{
+		{
+			name: "all fields",
+			body: `redises:
+  - addr: redis-1:6379
+    labels: {owner: team-a}
+    nodes: 3
+    username: app
+    password-env: REDIS_PASSWORD
+    tls: true
+    max-load: 60
+    engine: valkey
+  - addr: redis-2:6379
+    password-file: /run/secrets/redis-2`,
+		},
+		{
+			name: "both password references",
+			body: `{"redises": [{"addr": "redis-1:6379", "password-env": "A", "password-file": "b"}]}`,
+			err:  "only one of password-env and password-file can be set",
+		},
+		{
+			name: "negative nodes",
+			body: `{"redises": [{"addr": "redis-1:6379", "nodes": -1}]}`,
+			err:  "nodes must not be negative",
+		},
+		{
+			name: "plain password",
+			body: `{"redises": [{"addr": "redis-1:6379", "password": "secret"}]}`,
+			err:  "field password not found",
+		},
+		{
+			name: "duplicate address",
+			body: `{"redises": [{"addr": "redis-1:6379"}, {"addr": "redis-1:6379"}]}`,
+			err:  `duplicate address "redis-1:6379"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseInventory([]byte(tc.body), "inventory")
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("got error %v, want one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCredentialsEndpoint(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const env = "REDIS_COST_TEST_PASSWORD"
+	os.Setenv(env, "from-env")
+	defer os.Unsetenv(env)
+
+	for _, tc := range []struct {
+		name  string
+		creds redisCredentials
+		want  sizing.Endpoint
+		err   string
+	}{
+		{name: "none", want: sizing.Endpoint{Addr: "redis:6379"}},
+		{
+			name:  "env",
+			creds: redisCredentials{Username: "app", PasswordEnv: env, TLS: true},
+			want:  sizing.Endpoint{Addr: "redis:6379", Username: "app", Password: "from-env", TLS: true},
+		},
+		{
+			name:  "file",
+			creds: redisCredentials{PasswordFile: passwordFile},
+			want:  sizing.Endpoint{Addr: "redis:6379", Password: "from-file"},
+		},
+		{
+			name:  "unset env",
+			creds: redisCredentials{PasswordEnv: env + "_UNSET"},
+			err:   "password environment variable " + env + "_UNSET is not set",
+		},
+		{
+			name:  "missing file",
+			creds: redisCredentials{PasswordFile: passwordFile + ".missing"},
+			err:   "reading password",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.creds.endpoint("redis:6379")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
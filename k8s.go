@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// k8sSource discovers Redis pods or services in Kubernetes by label selector
+// across all namespaces. It relies on kubectl being installed, which takes
+// care of kubeconfig handling and authentication plugins.
+type k8sSource struct {
+	Selector    string // label selector, i.e. app=redis
+	Kind        string // either "pods" or "services"
+	Kubeconfig  string // optional kubeconfig path
+	Context     string // optional kubeconfig context
+	PortName    string // name of container or service port Redis listens on
+	Port        int    // Redis port used if no port named PortName found
+	PortForward bool   // reach Redis over kubectl port-forward
+	Kubectl     string // kubectl binary
+
+	// How long to wait for port-forward to start listening
+	PortForwardTimeout time.Duration
+}
+
+func (ks *k8sSource) validate() error {
+	switch ks.Kind {
+	case "pods", "services":
+	default:
+		return errors.New("Kubernetes object kind must be either pods or services")
+	}
+	if ks.Port < 1 || ks.Port > 65535 {
+		return errors.New("Kubernetes Redis port must be in [1,65535] range")
+	}
+	return nil
+}
+
+// k8sRedis is a Redis instance found in Kubernetes
+type k8sRedis struct {
+	Namespace string
+	Name      string // pod or service name
+	Addr      string // pod IP or service DNS name and port
+	Port      int
+	Labels    map[string]string
+}
+
+// stats returns memory stats of Redis instances matching ks.Selector, sorted
+// by namespace and name. Each RedisStats has k8s-namespace and k8s-pod or
+// k8s-service labels set.
+func (ks *k8sSource) stats(ctx context.Context, scan *sizing.KeyspaceScan) ([]sizing.RedisStats, error) {
+	found, err := ks.redises(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no Kubernetes %s found matching %q selector", ks.Kind, ks.Selector)
+	}
+	addrs := make([]string, len(found))
+	for i, r := range found {
+		addrs[i] = r.Addr
+	}
+	if ks.PortForward {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel() // stops port-forward processes
+		for i, r := range found {
+			if addrs[i], err = ks.portForward(ctx, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	out, err := sizing.LiveStats(ctx, addrs, scan)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range found {
+		out[i].Addr = r.Addr
+		out[i].Labels = r.Labels
+	}
+	return out, nil
+}
+
+// redises lists pods or services matching ks.Selector. Only running pods
+// with IP address assigned are returned.
+func (ks *k8sSource) redises(ctx context.Context) ([]k8sRedis, error) {
+	b, err := ks.kubectl(ctx, "get", ks.Kind, "--all-namespaces", "--selector", ks.Selector, "--output", "json").Output()
+	if err != nil {
+		return nil, kubectlError(err)
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name      string
+				Namespace string
+			}
+			Spec struct {
+				Containers []struct {
+					Ports []k8sPort
+				}
+				Ports []k8sPort // services
+			}
+			Status struct {
+				Phase string
+				PodIP string
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("parsing kubectl output: %w", err)
+	}
+	var out []k8sRedis
+	for _, it := range list.Items {
+		r := k8sRedis{
+			Namespace: it.Metadata.Namespace,
+			Name:      it.Metadata.Name,
+			Port:      ks.Port,
+			Labels:    map[string]string{"k8s-namespace": it.Metadata.Namespace},
+		}
+		ports := it.Spec.Ports
+		for _, c := range it.Spec.Containers {
+			ports = append(ports, c.Ports...)
+		}
+		for _, p := range ports {
+			if p.Name == ks.PortName {
+				r.Port = p.port()
+				break
+			}
+		}
+		host := it.Metadata.Name + "." + it.Metadata.Namespace + ".svc"
+		if ks.Kind == "pods" {
+			if it.Status.Phase != "Running" || it.Status.PodIP == "" {
+				continue
+			}
+			host = it.Status.PodIP
+			r.Labels["k8s-pod"] = it.Metadata.Name
+		} else {
+			r.Labels["k8s-service"] = it.Metadata.Name
+		}
+		r.Addr = net.JoinHostPort(host, strconv.Itoa(r.Port))
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace == out[j].Namespace {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Namespace < out[j].Namespace
+	})
+	return out, nil
+}
+
+// portForward starts kubectl port-forward to Redis on a random local port and
+// returns local address to connect to. Process runs until ctx is canceled. It
+// is killed if it doesn't report listening on a port within
+// ks.PortForwardTimeout.
+func (ks *k8sSource) portForward(ctx context.Context, r k8sRedis) (string, error) {
+	target := "pod/" + r.Name
+	if ks.Kind == "services" {
+		target = "service/" + r.Name
+	}
+	cmd := ks.kubectl(ctx, "port-forward", "--namespace", r.Namespace, "--address", "127.0.0.1",
+		target, ":"+strconv.Itoa(r.Port))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	// kubectl prints "Forwarding from 127.0.0.1:40123 -> 6379" once ready
+	ready := make(chan string, 1)
+	go func() {
+		defer close(ready)
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 3 || fields[0] != "Forwarding" || fields[1] != "from" {
+				continue
+			}
+			ready <- fields[2]
+			io.Copy(ioutil.Discard, stdout)
+			return
+		}
+	}()
+	readyCtx, cancel := context.WithTimeout(ctx, ks.PortForwardTimeout)
+	defer cancel()
+	select {
+	case addr, ok := <-ready:
+		if ok {
+			go cmd.Wait()
+			return addr, nil
+		}
+		cmd.Wait()
+		return "", fmt.Errorf("port-forward to %s/%s failed: %s", r.Namespace, r.Name, strings.TrimSpace(stderr.String()))
+	case <-readyCtx.Done():
+		cmd.Process.Kill()
+		cmd.Wait()
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("port-forward to %s/%s not ready after %v: %s", r.Namespace, r.Name,
+			ks.PortForwardTimeout, strings.TrimSpace(stderr.String()))
+	}
+}
+
+func (ks *k8sSource) kubectl(ctx context.Context, args ...string) *exec.Cmd {
+	var global []string
+	if ks.Kubeconfig != "" {
+		global = append(global, "--kubeconfig", ks.Kubeconfig)
+	}
+	if ks.Context != "" {
+		global = append(global, "--context", ks.Context)
+	}
+	return exec.CommandContext(ctx, ks.Kubectl, append(global, args...)...)
+}
+
+// kubectlError adds kubectl stderr output to err, if any
+func kubectlError(err error) error {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && len(ee.Stderr) != 0 {
+		return fmt.Errorf("kubectl: %w: %s", err, bytes.TrimSpace(ee.Stderr))
+	}
+	return fmt.Errorf("kubectl: %w", err)
+}
+
+// k8sPort is either container or service port
+type k8sPort struct {
+	Name          string
+	Port          int // services
+	ContainerPort int // pods
+}
+
+func (p k8sPort) port() int {
+	if p.ContainerPort != 0 {
+		return p.ContainerPort
+	}
+	return p.Port
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeKubectlScript answers "get pods" and "get services" with pods.json and
+// services.json files next to it, and "port-forward" to pod/ready or
+// service/ready with a ready message for $FAKE_REDIS_ADDR, to pod/hang with
+// nothing, and to anything else with an error. Its arguments are appended to
+// args file.
+const fakeKubectlScript = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$@" >> "$dir/args"
+while [ "$1" = --kubeconfig ] || [ "$1" = --context ]; do shift 2; done
+case "$1" in
+get)
+	cat "$dir/$2.json"
+	;;
+port-forward)
+	case "$6" in
+	pod/ready|service/ready)
+		echo "Forwarding from $FAKE_REDIS_ADDR -> ${7#:}"
+		exec sleep 30
+		;;
+	pod/hang)
+		exec sleep 30
+		;;
+	esac
+	echo "error: $6 not found" >&2
+	exit 1
+	;;
+esac
+`
+
+const testPodsJSON = `{"items": [
+	{"metadata": {"name": "redis-1", "namespace": "prod"},
+	 "spec": {"containers": [{"ports": [{"name": "metrics", "containerPort": 9121}, {"name": "redis", "containerPort": 6380}]}]},
+	 "status": {"phase": "Running", "podIP": "10.1.0.2"}},
+	{"metadata": {"name": "redis-0", "namespace": "prod"},
+	 "spec": {"containers": [{"ports": [{"name": "redis", "containerPort": 6380}]}]},
+	 "status": {"phase": "Running", "podIP": "10.1.0.1"}},
+	{"metadata": {"name": "redis-2", "namespace": "prod"},
+	 "spec": {"containers": [{"ports": [{"name": "redis", "containerPort": 6380}]}]},
+	 "status": {"phase": "Pending"}},
+	{"metadata": {"name": "cache", "namespace": "dev"},
+	 "spec": {"containers": [{}]},
+	 "status": {"phase": "Running", "podIP": "10.2.0.1"}}
+]}`
+
+const testServicesJSON = `{"items": [
+	{"metadata": {"name": "redis", "namespace": "prod"},
+	 "spec": {"ports": [{"name": "redis", "port": 6379}]}}
+]}`
+
+// fakeKubectl puts fake kubectl on PATH and returns directory it lives in
+func fakeKubectl(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl is a shell script")
+	}
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"pods.json":     testPodsJSON,
+		"services.json": testServicesJSON,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(fakeKubectlScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+	return dir
+}
+
+func TestK8sRedises(t *testing.T) {
+	dir := fakeKubectl(t)
+	for _, tc := range []struct {
+		kind string
+		want []k8sRedis
+	}{
+		{
+			kind: "pods",
+			want: []k8sRedis{
+				{Namespace: "dev", Name: "cache", Addr: "10.2.0.1:6379", Port: 6379,
+					Labels: map[string]string{"k8s-namespace": "dev", "k8s-pod": "cache"}},
+				{Namespace: "prod", Name: "redis-0", Addr: "10.1.0.1:6380", Port: 6380,
+					Labels: map[string]string{"k8s-namespace": "prod", "k8s-pod": "redis-0"}},
+				{Namespace: "prod", Name: "redis-1", Addr: "10.1.0.2:6380", Port: 6380,
+					Labels: map[string]string{"k8s-namespace": "prod", "k8s-pod": "redis-1"}},
+			},
+		},
+		{
+			kind: "services",
+			want: []k8sRedis{
+				{Namespace: "prod", Name: "redis", Addr: "redis.prod.svc:6379", Port: 6379,
+					Labels: map[string]string{"k8s-namespace": "prod", "k8s-service": "redis"}},
+			},
+		},
+	} {
+		t.Run(tc.kind, func(t *testing.T) {
+			ks := k8sSource{Selector: "app=redis", Kind: tc.kind, Context: "prod-cluster",
+				PortName: "redis", Port: 6379, Kubectl: "kubectl"}
+			got, err := ks.redises(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got\n%+v\nwant\n%+v", got, tc.want)
+			}
+		})
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--context prod-cluster get pods --all-namespaces --selector app=redis --output json\n"; !strings.HasPrefix(string(b), want) {
+		t.Errorf("got kubectl arguments\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestK8sPortForward(t *testing.T) {
+	fakeKubectl(t)
+	const fakeAddr = "127.0.0.1:40123"
+	os.Setenv("FAKE_REDIS_ADDR", fakeAddr)
+	defer os.Unsetenv("FAKE_REDIS_ADDR")
+	for _, tc := range []struct {
+		name, kind, target string
+		want, err          string
+	}{
+		{name: "pod", kind: "pods", target: "ready", want: fakeAddr},
+		{name: "service", kind: "services", target: "ready", want: fakeAddr},
+		{name: "error", kind: "pods", target: "missing", err: "port-forward to prod/missing failed: error: pod/missing not found"},
+		{name: "timeout", kind: "pods", target: "hang", err: "port-forward to prod/hang not ready after 100ms"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ks := k8sSource{Kind: tc.kind, Kubectl: "kubectl", PortForwardTimeout: 100 * time.Millisecond}
+			start := time.Now()
+			got, err := ks.portForward(ctx, k8sRedis{Namespace: "prod", Name: tc.target, Port: 6379})
+			if tc.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one starting with %q", err, tc.err)
+				}
+				if d := time.Since(start); d > 10*time.Second {
+					t.Errorf("port-forward took %v to fail", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestK8sStatsPortForward(t *testing.T) {
+	dir := fakeKubectl(t)
+	os.Setenv("FAKE_REDIS_ADDR", fakeRedis(t, testInfo))
+	defer os.Unsetenv("FAKE_REDIS_ADDR")
+	if err := ioutil.WriteFile(filepath.Join(dir, "services.json"), []byte(`{"items": [
+		{"metadata": {"name": "ready", "namespace": "prod"}, "spec": {"ports": [{"name": "redis", "port": 6379}]}}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ks := k8sSource{Selector: "app=redis", Kind: "services", PortName: "redis", Port: 6379, PortForward: true,
+		Kubectl: "kubectl", PortForwardTimeout: 10 * time.Second}
+	stats, err := ks.stats(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(stats))
+	}
+	st := stats[0]
+	if st.Addr != "ready.prod.svc:6379" || st.UsedBytes != 2<<30 || st.Labels["k8s-service"] != "ready" {
+		t.Errorf("got %+v", st)
+	}
+}
@@ -6,53 +6,121 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
-	"html/template"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/Doist/elasticache-redis-cost/sizing"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/pricing"
-	"github.com/go-redis/redis/v8"
-	"github.com/jmespath/go-jmespath"
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
 	log.SetFlags(0)
-	args := runArgs{
-		region:     "us-east-1",
-		maxLoadPct: 80,
-		resMemPct:  defaultReservedMemoryPercent,
+	if len(os.Args) > 1 {
+		for _, c := range subcommands {
+			if os.Args[1] != c.name {
+				continue
+			}
+			if err := c.run(os.Args[2:]); err != nil {
+				os.Stderr.WriteString(err.Error() + "\n")
+				os.Exit(1)
+			}
+			return
+		}
 	}
-	flag.StringVar(&args.region, "region", args.region,
-		"use prices for this AWS `region`")
+	args := newRunArgs()
+	args.sizingFlags(flag.CommandLine)
+	args.pricingFlags(flag.CommandLine)
+	args.outputFlags(flag.CommandLine)
+	flag.Float64Var(&args.targetHitRatio, "target-hit-ratio", args.targetHitRatio,
+		"for caches evicting keys, match offerings for memory estimated to reach this `percent` hit ratio\n"+
+			"instead of current memory usage, [0,100) range; 0 disables")
 	flag.StringVar(&args.input, "redises", "",
-		"`path` to file with Redis addresses, one per line (/dev/stdin to read from stdin)")
-	flag.StringVar(&args.html, "html", args.html,
-		"`path` to HTML file to save report; if empty, text report is printed to stdout")
-	flag.BoolVar(&args.withOldGen, "any-generation", args.withOldGen,
-		"take into account old generation instance types")
-	flag.BoolVar(&args.anyFamily, "any-family", args.anyFamily,
-		"take into account all instance families, not only memory-optimized")
-	flag.BoolVar(&args.csv, "csv", args.csv, "print report in CVS instead of formatted text")
-	flag.IntVar(&args.maxLoadPct, "max-load", args.maxLoadPct, "source dataset must fit this percent maxmemory utilization of the target, [1,100] range")
-	flag.IntVar(&args.resMemPct, "reserved-memory-percent", args.resMemPct, "value of reserved-memory-percent ElastiCache parameter, [0,100] range")
+		"`path` to file with Redis addresses, one per line (/dev/stdin to read from stdin),\n"+
+			"optionally followed by max-load=N, reserved-memory-percent=N, engine=NAME overrides")
+	flag.StringVar(&args.inventory, "inventory", "",
+		"`path` to YAML or JSON inventory file with Redis addresses, their labels and per-Redis overrides\n"+
+			"of max-load, reserved-memory-percent and engine")
+	flag.StringVar(&args.infoDumps, "info-dumps", "",
+		"`path` to directory or archive (.tar, .tar.gz, .tgz, .zip) with saved INFO outputs, one file per Redis;\n"+
+			"used instead of connecting to Redis addresses")
+	flag.Var(&args.rdbFiles, "rdb",
+		"`path` to RDB file to estimate memory usage from, can be repeated;\n"+
+			"used instead of connecting to Redis addresses")
+	flag.BoolVar(&args.elasticache, "elasticache", args.elasticache,
+		"discover ElastiCache for Redis nodes in the region and compare their node types to recommended ones;\n"+
+			"used instead of connecting to Redis addresses")
+	flag.StringVar(&args.ec.Stats, "elasticache-stats", args.ec.Stats,
+		"`source` of discovered ElastiCache nodes memory stats: info to connect to nodes, or cloudwatch;\n"+
+			"info uses TLS for clusters with in-transit encryption and AUTH token from "+authTokenEnv+"\n"+
+			"environment variable for clusters with AUTH enabled")
+	flag.StringVar(&args.ec.Endpoint, "elasticache-endpoint", "",
+		"custom ElastiCache API endpoint `url`")
+	flag.DurationVar(&args.ec.Window, "cloudwatch-window", args.ec.Window,
+		"time `window` to read ElastiCache CloudWatch metrics over")
+	flag.Float64Var(&args.ec.Percentile, "cloudwatch-percentile", args.ec.Percentile,
+		"`percentile` of ElastiCache BytesUsedForCache CloudWatch metric used as used memory, (0,100] range;\n"+
+			"peak memory is the maximum")
+	flag.StringVar(&args.ec.CloudWatchEndpoint, "cloudwatch-endpoint", "",
+		"custom CloudWatch API endpoint `url`")
+	flag.Var(&args.ec2.Tags, "ec2-tag",
+		"discover Redis on running EC2 instances with this `key=value` tag, can be repeated to match all tags;\n"+
+			"used instead of connecting to Redis addresses")
+	flag.StringVar(&args.ec2.PortTag, "ec2-port-tag", args.ec2.PortTag,
+		"EC2 instance `tag` with comma-separated ports of Redis instances running on it")
+	flag.IntVar(&args.ec2.Port, "ec2-port", args.ec2.Port,
+		"Redis `port` on EC2 instances without port tag")
+	flag.StringVar(&args.ec2.Endpoint, "ec2-endpoint", "",
+		"custom EC2 API endpoint `url`")
+	flag.StringVar(&args.k8s.Selector, "k8s-selector", "",
+		"discover Redis in Kubernetes across all namespaces by this label `selector`, i.e. app=redis;\n"+
+			"used instead of connecting to Redis addresses")
+	flag.StringVar(&args.k8s.Kind, "k8s-kind", args.k8s.Kind,
+		"`kind` of Kubernetes objects to discover: pods or services")
+	flag.StringVar(&args.k8s.Kubeconfig, "kubeconfig", "",
+		"`path` to kubeconfig file, kubectl default is used if empty")
+	flag.StringVar(&args.k8s.Context, "k8s-context", "",
+		"kubeconfig `context` to use, current context is used if empty")
+	flag.StringVar(&args.k8s.PortName, "k8s-port-name", args.k8s.PortName,
+		"`name` of container or service port Redis listens on")
+	flag.IntVar(&args.k8s.Port, "k8s-port", args.k8s.Port,
+		"Redis `port` on Kubernetes pods or services without named port")
+	flag.BoolVar(&args.k8s.PortForward, "k8s-port-forward", args.k8s.PortForward,
+		"connect to discovered Redis over kubectl port-forward, i.e. when running outside of the cluster")
+	flag.StringVar(&args.k8s.Kubectl, "kubectl", args.k8s.Kubectl, "kubectl binary `path`")
+	flag.StringVar(&args.prom.URL, "prometheus", "",
+		"base `url` of Prometheus server scraping redis_exporter to get Redis stats from,\n"+
+			"used instead of connecting to Redis addresses")
+	flag.StringVar(&args.prom.Label, "prometheus-label", args.prom.Label,
+		"Prometheus `label` identifying individual Redis instances")
+	flag.StringVar(&args.prom.Selector, "prometheus-selector", "",
+		"additional Prometheus label `matchers` to select Redis instances, i.e. job=\"redis\"")
+	flag.DurationVar(&args.prom.Range, "prometheus-range", args.prom.Range,
+		"time `range` to look for peak memory usage over in Prometheus")
+	flag.StringVar(&args.groupBy, "group-by", "",
+		"group report rows by this Redis `label` and print subtotals and a summary of groups")
+	flag.BoolVar(&args.deepScan, "deep-scan", args.deepScan,
+		"scan keyspace of each Redis and report top key prefixes by memory usage, sampled with MEMORY USAGE")
+	flag.IntVar(&args.scan.Rate, "scan-rate", args.scan.Rate, "deep scan at most this many keys per second on each Redis")
+	flag.Float64Var(&args.scan.Sample, "scan-sample", args.scan.Sample,
+		"fraction of scanned keys to sample memory usage of, (0,1] range")
+	flag.StringVar(&args.scan.Delimiter, "prefix-delimiter", args.scan.Delimiter,
+		"key prefix is the part of the key before the first occurrence of this `delimiter`")
+	flag.IntVar(&args.scan.Top, "top-prefixes", args.scan.Top, "number of top key prefixes to report for each Redis")
 	flag.Parse()
+	args.ec.AuthToken = os.Getenv(authTokenEnv)
 	if err := run(args); err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
@@ -61,30 +129,246 @@ func main() {
 
 const defaultReservedMemoryPercent = 25
 
+// subcommands are run instead of the default report mode if program's first
+// argument is their name, they parse the rest of arguments themselves
+var subcommands = []struct {
+	name string
+	help string
+	run  func(args []string) error
+}{
+	{"fits", "match node types to memory sizes without connecting to Redis", fitsMain},
+	{"offerings", "list node types with their attributes and prices", offeringsMain},
+	{"price-diff", "compare recommendations under two pricing snapshots", priceDiffMain},
+	{"report-diff", "compare two JSON reports", reportDiffMain},
+	{"serve", "run HTTP API server", serveMain},
+	{"snapshot", "save prices of all node types to a pricing snapshot file", snapshotMain},
+}
+
 type runArgs struct {
-	region     string
-	input      string
-	html       string
-	withOldGen bool
-	anyFamily  bool
-	csv        bool
-	maxLoadPct int
-	resMemPct  int // reserved-memory-percent
+	region    string
+	input     string
+	inventory string
+	infoDumps string
+	rdbFiles  stringsFlag
+	prom      promSource
+
+	elasticache bool
+	ec          elasticacheSource
+	ec2         ec2Source
+	k8s         k8sSource
+	html        string
+	xlsx        string
+	withOldGen  bool
+	anyFamily   bool
+	csv         bool
+	json        bool
+	markdown    bool
+	groupBy     string // label to group report rows by
+	deepScan    bool
+	scan        sizing.KeyspaceScan
+	maxLoadPct  int
+	resMemPct   int    // reserved-memory-percent
+	engine      string // one of sizing.Engines keys, unless overridden per Redis
+
+	pricingSnapshot string // path to pricing snapshot file
+	bulkPrices      string // bulk price list offer file URL or path, "aws" for sizing.BulkPriceListURL
+	policy          sizing.MatchPolicy
+	candidates      int // number of cheapest candidates to report per Redis
+
+	targetHitRatio float64
+}
+
+// newRunArgs returns runArgs with default values of flags
+func newRunArgs() runArgs {
+	return runArgs{
+		region:     "us-east-1",
+		maxLoadPct: 80,
+		resMemPct:  defaultReservedMemoryPercent,
+		engine:     sizing.DefaultEngine,
+		scan: sizing.KeyspaceScan{
+			Rate:      1000,
+			Sample:    0.1,
+			Delimiter: ":",
+			Top:       10,
+		},
+		policy: sizing.MatchPolicy{Tolerance: 10},
+		ec2: ec2Source{
+			PortTag: "redis-port",
+			Port:    6379,
+		},
+		k8s: k8sSource{
+			Kind:     "pods",
+			PortName: "redis",
+			Port:     6379,
+			Kubectl:  "kubectl",
+
+			PortForwardTimeout: 30 * time.Second,
+		},
+		ec: elasticacheSource{
+			Stats:      "info",
+			Window:     30 * 24 * time.Hour,
+			Percentile: 95,
+		},
+		prom: promSource{
+			Label: "instance",
+			Range: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// offeringsFlags registers flags selecting offerings to fetch
+func (args *runArgs) offeringsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&args.region, "region", args.region,
+		"use prices for this AWS `region`")
+	fs.BoolVar(&args.withOldGen, "any-generation", args.withOldGen,
+		"take into account old generation instance types")
+	fs.BoolVar(&args.anyFamily, "any-family", args.anyFamily,
+		"take into account all instance families, not only memory-optimized")
+	fs.IntVar(&args.resMemPct, "reserved-memory-percent", args.resMemPct, "value of reserved-memory-percent ElastiCache parameter, [0,100] range")
+}
+
+// pricingFlags registers flags selecting source of prices
+func (args *runArgs) pricingFlags(fs *flag.FlagSet) {
+	fs.StringVar(&args.pricingSnapshot, "pricing-snapshot", "",
+		"`path` to pricing snapshot file to use prices from instead of AWS Price List API")
+	fs.StringVar(&args.bulkPrices, "bulk-prices", "",
+		"`source` of AWS bulk price list offer file to use prices from instead of AWS Price List API,\n"+
+			"either URL or path, {region} is replaced with region code; \"aws\" for the public AWS offer file")
+}
+
+// sizingFlags registers flags controlling how Redis is matched to offerings,
+// including offeringsFlags
+func (args *runArgs) sizingFlags(fs *flag.FlagSet) {
+	args.offeringsFlags(fs)
+	fs.Var((*stringsFlag)(&args.policy.Include), "include-type",
+		"only match instance types or families matching this glob `pattern`, i.e. cache.r* or r6g, can be repeated")
+	fs.Var((*stringsFlag)(&args.policy.Exclude), "exclude-type",
+		"never match instance types or families matching this glob `pattern`, i.e. cache.t*, can be repeated")
+	fs.Var((*stringsFlag)(&args.policy.Prefer), "prefer-family",
+		"prefer this instance `family`, i.e. r7g, if it's priced within -prefer-tolerance of the best fit;\n"+
+			"can be repeated in order of preference")
+	fs.Float64Var(&args.policy.Tolerance, "prefer-tolerance", args.policy.Tolerance,
+		"`percent` of price over the best fit preferred instance family may cost")
+	fs.BoolVar(&args.policy.SmallestFit, "smallest-fit", args.policy.SmallestFit,
+		"match the smallest fitting node type instead of the cheapest one")
+	fs.IntVar(&args.candidates, "candidates", args.candidates,
+		"report this many cheapest fitting node types for each Redis in HTML and JSON reports")
+	fs.IntVar(&args.maxLoadPct, "max-load", args.maxLoadPct, "source dataset must fit this percent maxmemory utilization of the target, [1,100] range")
+}
+
+// outputFlags registers flags selecting report format
+func (args *runArgs) outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&args.html, "html", args.html,
+		"`path` to HTML file to save report; if empty, text report is printed to stdout")
+	fs.BoolVar(&args.csv, "csv", args.csv, "print report in CVS instead of formatted text")
+	fs.BoolVar(&args.json, "json", args.json, "print report in JSON instead of formatted text")
+	fs.BoolVar(&args.markdown, "markdown", args.markdown, "print report in Markdown instead of formatted text")
+	fs.StringVar(&args.xlsx, "xlsx", args.xlsx,
+		"`path` to XLSX file to save report as spreadsheet with formula-based totals, parameters, and offerings")
+}
+
+// stringsFlag is a flag.Value collecting values of a repeated flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(s string) error {
+	if s == "" {
+		return errors.New("value cannot be empty")
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// parseSize parses memory size with optional unit, either decimal (KB, MB,
+// GB, TB) or binary (KiB, MiB, GiB, TiB), i.e. 800MB or 12.5GiB. Sizes
+// without unit are in bytes.
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i == -1 {
+		i = len(s)
+	}
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid size %q, must be a positive number with optional unit, i.e. 12GiB", s)
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported size unit %q in %q", s[i:], s)
+	}
+	return uint64(f * mult), nil
+}
+
+var sizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40,
 }
 
 func (args runArgs) validate() error {
 	if args.region == "" {
 		return errors.New("region cannot be empty")
 	}
-	if args.input == "" {
-		return errors.New("input file must be set")
+	var sources int
+	for _, s := range [...]string{args.input, args.inventory, args.infoDumps, args.prom.URL, args.rdbFiles.String(), args.ec2.Tags.String(),
+		args.k8s.Selector} {
+		if s != "" {
+			sources++
+		}
+	}
+	if args.elasticache {
+		sources++
+		if err := args.ec.validate(); err != nil {
+			return err
+		}
 	}
+	if sources != 1 {
+		return errors.New("exactly one of input file, inventory file, INFO dumps path, RDB files, Prometheus url," +
+			" ElastiCache, EC2 or Kubernetes discovery must be set")
+	}
+	if len(args.ec2.Tags) != 0 {
+		if err := args.ec2.validate(); err != nil {
+			return err
+		}
+	}
+	if args.k8s.Selector != "" {
+		if err := args.k8s.validate(); err != nil {
+			return err
+		}
+	}
+	if err := args.validateOutput(); err != nil {
+		return err
+	}
+	if args.deepScan {
+		if args.input == "" && args.inventory == "" && len(args.ec2.Tags) == 0 && args.k8s.Selector == "" {
+			return errors.New("deep scan is only supported with input or inventory file of Redis addresses," +
+				" EC2 or Kubernetes discovery")
+		}
+		if err := args.scan.Validate(); err != nil {
+			return err
+		}
+	}
+	return args.validateSizing()
+}
+
+// validateSizing validates arguments used to match Redis to offerings
+func (args runArgs) validateSizing() error {
 	if args.maxLoadPct < 1 || args.maxLoadPct > 100 {
 		return errors.New("max-load must be in [1,100] percent range")
 	}
 	if args.resMemPct < 0 || args.resMemPct > 100 {
 		return errors.New("reserved-memory-percent must be in [0,100] range")
 	}
+	if args.targetHitRatio < 0 || args.targetHitRatio >= 100 {
+		return errors.New("target-hit-ratio must be in [0,100) range")
+	}
+	if err := args.policy.Validate(); err != nil {
+		return err
+	}
+	if args.candidates < 0 {
+		return errors.New("number of candidates cannot be negative")
+	}
 	return nil
 }
 
@@ -105,19 +389,47 @@ func run(args runArgs) error {
 		log.Println("please make sure you understand how reserved-memory-percent parameter works")
 	}
 
-	f, err := os.Open(args.input)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	redises, err := readAddresses(f)
-	if err != nil {
-		return err
+	var endpoints []sizing.Endpoint
+	var redisesInfo []sizing.RedisStats
+	var entries []inventoryEntry // from either inventory or address file
+	if args.inventory != "" {
+		var err error
+		if entries, err = readInventory(args.inventory); err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return errors.New("no Redis addresses to work on")
+		}
+	} else if args.infoDumps != "" {
+		var err error
+		if redisesInfo, err = readInfoDumps(args.infoDumps); err != nil {
+			return err
+		}
+		if len(redisesInfo) == 0 {
+			return errors.New("no INFO dumps to work on")
+		}
+	} else if args.input != "" {
+		f, err := os.Open(args.input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if entries, err = readAddresses(f); err != nil {
+			return err
+		}
+		f.Close()
+		if len(entries) == 0 {
+			return errors.New("no Redis addresses to work on")
+		}
 	}
-	f.Close()
-
-	if len(redises) == 0 {
-		return errors.New("no Redis addresses to work on")
+	inventory := make(map[string]inventoryEntry, len(entries)) // keyed by address
+	for _, e := range entries {
+		ep, err := e.endpoint(e.Addr)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, ep)
+		inventory[e.Addr] = e
 	}
 
 	ctx := context.Background()
@@ -125,303 +437,305 @@ func run(args runArgs) error {
 	if err != nil {
 		return err
 	}
-
-	maxWorkers := len(redises)
-	const workerCap = 10
-	if maxWorkers > workerCap {
-		maxWorkers = workerCap
-	}
-	redisesInfo := make([]RedisStats, len(redises)) // preallocate for concurrent fill
-	type addrAndIndex struct {
-		addr  string
-		index int
+	prices, err := args.pricingProvider(sess)
+	if err != nil {
+		return err
 	}
-	jobs := make(chan addrAndIndex)
-	var offerings Offerings
 
+	offeringsKeys := args.offeringsKeys(inventory)
+	offeringSets := make([]sizing.Offerings, len(offeringsKeys))
+	var current map[string]sizing.Offering    // offerings of current node types of ElastiCache nodes by address
+	var metrics map[string]map[string]float64 // CloudWatch metrics of ElastiCache nodes by address
+
+	var scan *sizing.KeyspaceScan
+	if args.deepScan {
+		scan = &args.scan
+	}
 	group, ctx := errgroup.WithContext(ctx)
-	group.Go(func() error {
-		defer close(jobs)
-		for i, addr := range redises {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case jobs <- addrAndIndex{addr: addr, index: i}:
-			}
-		}
-		return nil
-	})
-	for i := 0; i < maxWorkers; i++ {
+	if len(endpoints) != 0 {
 		group.Go(func() error {
-			for job := range jobs {
-				used, peak, err := redisMemory(ctx, job.addr)
-				if err != nil {
-					return fmt.Errorf("%s: %w", job.addr, err)
-				}
-				redisesInfo[job.index] = RedisStats{Addr: job.addr, UsedBytes: used, PeakBytes: peak}
+			var err error
+			redisesInfo, err = sizing.EndpointStats(ctx, endpoints, scan)
+			return err
+		})
+	}
+	if len(args.ec2.Tags) != 0 {
+		group.Go(func() error {
+			found, err := args.ec2.redises(ctx, sess, args.region)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				return errors.New("no EC2 instances found with matching tags")
+			}
+			addrs := make([]string, len(found))
+			for i, r := range found {
+				addrs[i] = r.Addr
+			}
+			if redisesInfo, err = sizing.LiveStats(ctx, addrs, scan); err != nil {
+				return err
+			}
+			for i, r := range found {
+				redisesInfo[i].Labels = r.Labels
 			}
 			return nil
 		})
 	}
-	pricingFilters := []*pricing.Filter{
-		{
-			Field: aws.String("cacheEngine"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String("Redis"),
-		},
-		{
-			Field: aws.String("location"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String(region.Description()),
-		},
-	}
-	if !args.anyFamily {
-		pricingFilters = append(pricingFilters, &pricing.Filter{
-			Field: aws.String("instanceFamily"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String("Memory optimized"),
+	if args.k8s.Selector != "" {
+		group.Go(func() error {
+			var err error
+			redisesInfo, err = args.k8s.stats(ctx, scan)
+			return err
 		})
 	}
-	if !args.withOldGen {
-		pricingFilters = append(pricingFilters, &pricing.Filter{
-			Field: aws.String("currentGeneration"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String("yes"),
+	if len(args.rdbFiles) != 0 {
+		group.Go(func() error {
+			for _, name := range args.rdbFiles {
+				st, err := rdbStats(name)
+				if err != nil {
+					return err
+				}
+				redisesInfo = append(redisesInfo, st)
+			}
+			return nil
 		})
 	}
-	group.Go(func() error {
-		svc := pricing.New(sess)
-		res, err := svc.GetProductsWithContext(ctx, &pricing.GetProductsInput{
-			ServiceCode: aws.String("AmazonElastiCache"),
-			Filters:     pricingFilters,
-		})
-		if err != nil {
-			return err
-		}
-		for _, priceList := range res.PriceList {
-			memory, err := extractMemory(priceList["product"])
-			if err != nil {
+	if args.prom.URL != "" {
+		group.Go(func() error {
+			var err error
+			if redisesInfo, err = args.prom.stats(ctx); err != nil {
 				return err
 			}
-			instanceType, err := extractInstanceType(priceList["product"])
-			if err != nil {
-				return err
+			if len(redisesInfo) == 0 {
+				return errors.New("no Redis instances found in Prometheus")
 			}
-			price, err := extractPrice(priceList["terms"])
-			if err != nil {
+			return nil
+		})
+	}
+	if args.elasticache {
+		group.Go(func() error {
+			var nodes []cacheNode
+			var err error
+			if redisesInfo, nodes, err = args.ec.stats(ctx, sess, args.region); err != nil {
 				return err
 			}
-			if mem, ok := maxmemoryValues[instanceType]; ok {
-				memory = mem - (mem / 100 * uint64(args.resMemPct))
-			} else {
-				memory = memory - (memory / 100 * uint64(args.resMemPct))
-				log.Printf("exact maxmemory value for instance %q is unknown,"+
-					" using instance size corrected to reserved-memory-percent=%d",
-					instanceType, args.resMemPct)
-			}
-			offerings = append(offerings, Offering{
-				Memory:       memory,
-				PricePerHour: price,
-				InstanceType: instanceType,
-			})
-		}
-		offerings.sortByMemory()
-		return nil
-	})
+			metrics = nodesMetrics(nodes)
+			current, err = currentOfferings(ctx, prices, region.Description(), nodes, args.resMemPct)
+			return err
+		})
+	}
+	for i, key := range offeringsKeys {
+		i, key := i, key
+		group.Go(func() error {
+			var err error
+			offeringSets[i], err = fetchOfferings(ctx, prices, args.query(key, region.Description()))
+			return err
+		})
+	}
 
 	if err := group.Wait(); err != nil {
 		return err
 	}
-
-	rows := make([]reportRow, 0, len(redisesInfo))
-	for _, ri := range redisesInfo {
-		plan1, err := offerings.match(ri.UsedBytes, args.maxLoadPct)
-		if err != nil {
-			return fmt.Errorf("no matching plan for %q with %d GiB of used memory: %w", ri.Addr, ri.UsedBytes<<30, err)
-		}
-		plan2, err := offerings.match(ri.PeakBytes, args.maxLoadPct)
-		if err != nil {
-			return fmt.Errorf("no matching plan for %q with %d GiB of peak memory: %w", ri.Addr, ri.PeakBytes<<30, err)
-		}
-		rows = append(rows, reportRow{
-			Redis:     ri,
-			UsedRatio: float64(ri.UsedBytes) / float64(plan1.Memory) * 100,
-			PeakRatio: float64(ri.PeakBytes) / float64(plan2.Memory) * 100,
-			UsedBased: plan1,
-			PeakBased: plan2,
-		})
+	offerings := make(map[offeringsKey]sizing.Offerings, len(offeringsKeys))
+	for i, key := range offeringsKeys {
+		offerings[key] = offeringSets[i]
 	}
-	if args.html == "" {
-		if args.csv {
-			return writeCSVReport(os.Stdout, rows)
-		}
-		return writeTextReport(os.Stdout, rows)
-	}
-	page := struct {
-		Rows                  []reportRow
-		UsedBasedTotal        float64
-		PeakBasedTotal        float64
-		Time                  time.Time
-		Region                string
-		MaxLoad               int
-		ReservedMemoryPercent int
-	}{
-		Rows:                  rows,
-		Time:                  time.Now().UTC(),
-		Region:                region.Description(),
-		MaxLoad:               args.maxLoadPct,
-		ReservedMemoryPercent: args.resMemPct,
-	}
-	for _, row := range rows {
-		page.UsedBasedTotal += row.UsedBased.PricePerMonth()
-		page.PeakBasedTotal += row.PeakBased.PricePerMonth()
-	}
-	buf := new(bytes.Buffer)
-	if err := pageTemplate.Execute(buf, page); err != nil {
+
+	rep, err := args.report(redisesInfo, inventory, offerings, current, region.Description())
+	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(args.html, buf.Bytes(), 0666)
+	// the first key is the default one, see offeringsKeys
+	return args.writeReport(rep, offeringSets[0], metrics)
 }
 
-type Offerings []Offering
-
-func (ofs Offerings) sortByMemory() {
-	sort.Slice(ofs, func(i, j int) bool { return ofs[i].Memory < ofs[j].Memory })
-}
-
-func (ofs Offerings) match(size uint64, maxLoadPct int) (Offering, error) {
-	i := sort.Search(len(ofs), func(i int) bool { return ofs[i].Memory/100*uint64(maxLoadPct) >= size })
-	if i < len(ofs) {
-		return ofs[i], nil
+// validateOutput checks that at most one of report formats printed to stdout
+// is selected
+func (args runArgs) validateOutput() error {
+	var n int
+	for _, set := range []bool{args.csv, args.json, args.markdown} {
+		if set {
+			n++
+		}
 	}
-	return Offering{}, errors.New("no matching offering found")
-}
-
-type Offering struct {
-	Memory       uint64
-	PricePerHour float64
-	InstanceType string
-}
-
-func (o Offering) PricePerMonth() float64 {
-	return o.PricePerHour * 24 * 31
-}
-
-func (o Offering) MemoryGiB() float64 {
-	return float64(o.Memory>>20) / 1024
+	if n > 1 {
+		return errors.New("csv, json, and markdown report formats are mutually exclusive")
+	}
+	if args.html != "" && args.xlsx != "" {
+		return errors.New("html and xlsx report files are mutually exclusive")
+	}
+	return nil
 }
 
-type RedisStats struct {
-	Addr      string
-	UsedBytes uint64
-	PeakBytes uint64
+// writeReport writes report to stdout, or to HTML or XLSX file if args.html
+// or args.xlsx is set. Offerings are listed in XLSX file, CloudWatch metrics
+// of ElastiCache nodes, if any, are added to JSON report.
+func (args runArgs) writeReport(rep sizing.Report, ofs sizing.Offerings, metrics map[string]map[string]float64) error {
+	buf := new(bytes.Buffer)
+	switch {
+	case args.html != "":
+		if err := sizing.WriteHTML(buf, rep); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(args.html, buf.Bytes(), 0666)
+	case args.xlsx != "":
+		if err := sizing.WriteXLSX(buf, rep, ofs); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(args.xlsx, buf.Bytes(), 0666)
+	case args.csv:
+		return sizing.WriteCSV(os.Stdout, rep)
+	case args.json && metrics != nil:
+		return writeCloudWatchJSON(os.Stdout, rep, metrics)
+	case args.json:
+		return sizing.WriteJSON(os.Stdout, rep)
+	case args.markdown:
+		return sizing.WriteMarkdown(os.Stdout, rep)
+	}
+	return sizing.WriteText(os.Stdout, rep)
 }
 
-func (s RedisStats) UsedGiB() float64 { return float64(s.UsedBytes>>20) / 1024 }
-func (s RedisStats) PeakGiB() float64 { return float64(s.PeakBytes>>20) / 1024 }
-
-type reportRow struct {
-	Redis     RedisStats
-	UsedRatio float64
-	PeakRatio float64
-	UsedBased Offering
-	PeakBased Offering
+// pricingProvider returns provider of AWS price list products, which is either
+// pricing snapshot file, bulk price list offer file, or AWS Price List API
+func (args runArgs) pricingProvider(sess *session.Session) (sizing.Provider, error) {
+	if args.pricingSnapshot != "" && args.bulkPrices != "" {
+		return nil, errors.New("pricing snapshot and bulk prices are mutually exclusive")
+	}
+	if args.bulkPrices != "" {
+		return sizing.NewBulkProvider(bulkPricesSource(args.bulkPrices), nil), nil
+	}
+	if args.pricingSnapshot == "" {
+		return sizing.NewAPIProvider(pricing.New(sess)), nil
+	}
+	return readSnapshot(args.pricingSnapshot)
 }
 
-var queryPrice = jmespath.MustCompile("OnDemand.*[].priceDimensions.*[].pricePerUnit.USD | [0]")
-var queryIstanceType = jmespath.MustCompile("attributes.instanceType")
-var queryMemory = jmespath.MustCompile("attributes.memory")
-
-func extractInstanceType(data interface{}) (string, error) {
-	raw, err := queryIstanceType.Search(data)
+func readSnapshot(name string) (*sizing.Snapshot, error) {
+	f, err := os.Open(name)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	s, ok := raw.(string)
-	if !ok {
-		return "", fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+	defer f.Close()
+	s, err := sizing.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 	return s, nil
 }
 
-func extractMemory(data interface{}) (uint64, error) {
-	raw, err := queryMemory.Search(data)
-	if err != nil {
-		return 0, err
-	}
-	s, ok := raw.(string)
-	if !ok {
-		return 0, fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+// bulkPricesSource returns bulk price list source set with -bulk-prices flag
+func bulkPricesSource(flagValue string) string {
+	if flagValue == "aws" {
+		return sizing.BulkPriceListURL
 	}
-	const suffix = " GiB"
-	if !strings.HasSuffix(s, suffix) {
-		return 0, fmt.Errorf("unsupported memory spec format, want \"XXX GiB\", got %q", s)
-	}
-	gibs, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 32)
-	if err != nil {
-		return 0, err
+	return flagValue
+}
+
+// offeringsKeys returns keys of offerings to fetch: for default engine and
+// reserved-memory-percent, and for any other combination set in inventory
+// overrides
+func (args runArgs) offeringsKeys(inventory map[string]inventoryEntry) []offeringsKey {
+	_, defaultKey := hostOverrides{}.effective(args)
+	keys := []offeringsKey{defaultKey}
+	seen := map[offeringsKey]bool{defaultKey: true}
+	for _, e := range inventory {
+		if _, key := e.effective(args); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
 	}
-	if gibs <= 0 {
-		return 0, fmt.Errorf("unexpected memory value %v (%q)", gibs, s)
+	return keys
+}
+
+// query returns query to fetch offerings identified by key in location
+func (args runArgs) query(key offeringsKey, location string) sizing.OfferingsQuery {
+	return sizing.OfferingsQuery{
+		Engine:                key.Engine,
+		Location:              location,
+		AnyFamily:             args.anyFamily,
+		AnyGeneration:         args.withOldGen,
+		ReservedMemoryPercent: key.ResMemPct,
 	}
-	return uint64(gibs * 1024 * 1024 * 1024), nil
 }
 
-func extractPrice(data interface{}) (float64, error) {
-	raw, err := queryPrice.Search(data)
+// fetchOfferings is sizing.FetchOfferings logging offerings with estimated
+// memory
+func fetchOfferings(ctx context.Context, p sizing.Provider, q sizing.OfferingsQuery) (sizing.Offerings, error) {
+	ofs, err := sizing.FetchOfferings(ctx, p, q)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	s, ok := raw.(string)
-	if !ok {
-		return 0, fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+	for _, o := range ofs {
+		if o.MaxmemoryEstimated {
+			log.Printf("exact maxmemory value for instance %q is unknown,"+
+				" using instance size corrected to reserved-memory-percent=%d",
+				o.InstanceType, q.ReservedMemoryPercent)
+		}
 	}
-	return strconv.ParseFloat(s, 64)
+	return ofs, nil
 }
 
-func redisMemory(ctx context.Context, addr string) (uint64, uint64, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	client := redis.NewClient(&redis.Options{Addr: addr})
-	defer client.Close()
-	data, err := client.Info(ctx, "memory").Bytes()
-	if err != nil {
-		return 0, 0, err
-	}
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	var used, peak uint64
-	for scanner.Scan() {
-		const usedPrefix = "used_memory:"
-		const peakPrefix = "used_memory_peak:"
-		var err error
-		switch b := scanner.Bytes(); {
-		case bytes.HasPrefix(b, []byte(usedPrefix)):
-			if used, err = strconv.ParseUint(string(b[len(usedPrefix):]), 10, 64); err != nil {
-				return 0, 0, err
-			}
-		case bytes.HasPrefix(b, []byte(peakPrefix)):
-			if peak, err = strconv.ParseUint(string(b[len(peakPrefix):]), 10, 64); err != nil {
-				return 0, 0, err
-			}
+// report matches stats to offerings, applying per-Redis inventory overrides.
+// Offerings must have sets for all keys returned by args.offeringsKeys for
+// the same inventory. Current maps addresses to offerings of their current
+// node types, if known.
+func (args runArgs) report(stats []sizing.RedisStats, inventory map[string]inventoryEntry,
+	offerings map[offeringsKey]sizing.Offerings, current map[string]sizing.Offering, location string) (sizing.Report, error) {
+	rows := make([]sizing.ReportRow, 0, len(stats))
+	for _, ri := range stats {
+		var ov hostOverrides
+		var nodes int
+		if e, ok := inventory[ri.Addr]; ok {
+			ri.Labels, ov, nodes = e.Labels, e.hostOverrides, e.Nodes
 		}
-		if used > 0 && peak > 0 {
-			break
+		if ri.Evicting() {
+			log.Printf("%s: cache evicted %d keys with maxmemory-policy %q at %.1f%% hit ratio,"+
+				" its memory usage is capped by maxmemory", ri.Addr, ri.EvictedKeys, ri.MaxmemoryPolicy, ri.HitRatio())
 		}
-	}
-	return used, peak, scanner.Err()
+		maxLoadPct, key := ov.effective(args)
+		row, err := sizing.NewReportRow(ri, offerings[key], sizing.RowOptions{
+			MaxLoad:               maxLoadPct,
+			ReservedMemoryPercent: key.ResMemPct,
+			Engine:                key.Engine,
+			TargetHitRatio:        args.targetHitRatio,
+			Policy:                args.policy,
+			Candidates:            args.candidates,
+			Nodes:                 nodes,
+		})
+		if err != nil {
+			return sizing.Report{}, err
+		}
+		if o, ok := current[ri.Addr]; ok {
+			row.Current = &o
+		}
+		rows = append(rows, row)
+	}
+	rep := sizing.NewReport(rows, args.groupBy)
+	rep.Region = location
+	rep.MaxLoad = args.maxLoadPct
+	rep.ReservedMemoryPercent = args.resMemPct
+	rep.Engine = args.engine
+	rep.TargetHitRatio = args.targetHitRatio
+	return rep, nil
 }
 
-func readAddresses(rd io.Reader) ([]string, error) {
-	var out []string
+// readAddresses reads Redis addresses in HOST:PORT format, one per line,
+// optionally followed by space-separated overrides:
+//
+//	redis-1.example.com:6379 max-load=60 reserved-memory-percent=50 engine=valkey
+func readAddresses(rd io.Reader) ([]inventoryEntry, error) {
+	var out []inventoryEntry
+	seen := make(map[string]int) // address to line number
 	scanner := bufio.NewScanner(rd)
-	for scanner.Scan() {
+	for lineNum := 1; scanner.Scan(); lineNum++ {
 		if b := scanner.Bytes(); bytes.HasPrefix(b, []byte("#")) || len(b) == 0 {
 			continue
 		}
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
 			continue
 		}
+		line := fields[0]
 		host, port, err := net.SplitHostPort(line)
 		if err != nil {
 			return nil, err
@@ -429,65 +743,36 @@ func readAddresses(rd io.Reader) ([]string, error) {
 		if host == "" || port == "" {
 			return nil, fmt.Errorf("%q does not look like a valid address in HOST:PORT format", line)
 		}
-		out = append(out, line)
-	}
-	return out, scanner.Err()
-}
-
-func writeTextReport(w io.Writer, rows []reportRow) error {
-	tw := tabwriter.NewWriter(w, 1, 4, 1, ' ', 0)
-	defer tw.Flush()
-	fmt.Fprintf(tw, "HOST\tUSED(LOAD)\tTYPE\t$/HR\t$/MONTH\tPEAK(LOAD)\tTYPE\t$/HR\t$/MONTH\t\n")
-	for _, row := range rows {
-		fmt.Fprintf(tw, "%s\t%.1f (%.1f%%)\t%s\t%.3f\t%.3f\t%.1f (%.1f%%)\t%s\t%.3f\t%.3f\t\n", row.Redis.Addr,
-			row.Redis.UsedGiB(), row.UsedRatio,
-			row.UsedBased.InstanceType, row.UsedBased.PricePerHour, row.UsedBased.PricePerMonth(),
-			row.Redis.PeakGiB(), row.PeakRatio,
-			row.PeakBased.InstanceType, row.PeakBased.PricePerHour, row.PeakBased.PricePerMonth(),
-		)
-	}
-	return tw.Flush()
-}
-
-func writeCSVReport(w io.Writer, rows []reportRow) error {
-	wr := csv.NewWriter(w)
-	defer wr.Flush()
-	csvRow := []string{"host",
-		"used memory (gib)", "instance type (use-based)",
-		"instance memory (use-based)", "usd/month (use-based)",
-		"peak memory (gib)", "instance type (peak-based)",
-		"instance memory (peak-based)", "usd/month (peak-based)",
-	}
-	if err := wr.Write(csvRow); err != nil {
-		return err
-	}
-	for _, row := range rows {
-		csvRow = append(csvRow[:0], row.Redis.Addr,
-			strconv.FormatFloat(row.Redis.UsedGiB(), 'f', 2, 64),
-			row.UsedBased.InstanceType,
-			strconv.FormatFloat(row.UsedBased.MemoryGiB(), 'f', 2, 64),
-			strconv.FormatFloat(row.UsedBased.PricePerMonth(), 'f', 3, 64),
-			strconv.FormatFloat(row.Redis.PeakGiB(), 'f', 2, 64),
-			row.PeakBased.InstanceType,
-			strconv.FormatFloat(row.PeakBased.MemoryGiB(), 'f', 2, 64),
-			strconv.FormatFloat(row.PeakBased.PricePerMonth(), 'f', 3, 64),
-		)
-		if err := wr.Write(csvRow); err != nil {
-			return err
+		if prev, ok := seen[line]; ok {
+			return nil, fmt.Errorf("line %d: duplicate address %q, first seen on line %d", lineNum, line, prev)
+		}
+		seen[line] = lineNum
+		e := inventoryEntry{Addr: line}
+		for _, kv := range fields[1:] {
+			if err := e.set(kv); err != nil {
+				return nil, fmt.Errorf("%s: %w", line, err)
+			}
 		}
+		out = append(out, e)
 	}
-	wr.Flush()
-	return wr.Error()
+	return out, scanner.Err()
 }
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", filepath.Base(os.Args[0]))
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage of %s:\n", progName())
 		flag.PrintDefaults()
+		fmt.Fprintf(out, "\nSubcommands, run %s SUBCOMMAND -h for their usage:\n\n", progName())
+		for _, c := range subcommands {
+			fmt.Fprintf(out, "  %-11s %s\n", c.name, c.help)
+		}
 		fmt.Fprintln(flag.CommandLine.Output(), reservedMemoryPercentNote)
 	}
 }
 
+func progName() string { return filepath.Base(os.Args[0]) }
+
 const reservedMemoryPercentNote = `
 Please see AWS documentation regarding reserved-memory-percent if you decide to change it:
 
@@ -501,94 +786,4 @@ https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redi
 > memory for non-Redis purposes to help reduce the amount of paging.
 
 > This parameter is specific to ElastiCache, and is not part of the standard
-> Redis distribution.
-`
-
-var pageTemplate = template.Must(template.New("page").Parse(`<!doctype html><head><meta charset="utf-8">
-<title>Redis instances matched to ElastiCache Redis instances</title>
-<style>
-	html {line-height: 1.3; font-family: ui-serif, serif;}
-	table, code {font-family: ui-monospace, monospace;}
-	caption {padding:1em; caption-side: top; font-weight: bold; font-family: ui-sans-serif, sans-serif;}
-	th, td {padding: 0.1rem .5rem;}
-	td {white-space: nowrap;}
-	th {vertical-align: middle; text-align: center; background-color: #eee;}
-	tr:nth-child(even) td {background-color: #f8f8f8;}
-	tr:hover td {background-color: #eee;}
-	.right {text-align: right;}
-	.warn {text-color: darkred;}
-	tfoot td {font-weight: bold;}
-	#footnote {max-width:50em;}
-</style>
-</head>
-<body>
-<table>
-<caption>Estimate on ElastiCache instances required to cover Redis instances<br>
-based on memory readings from {{.Time.Format "2006-01-02 15:04"}} UTC,<br>
-using {{.MaxLoad}}% <a href="#footnote">max memory load target</a><sup>*</sup>
-and <code>reserved-memory-percent={{.ReservedMemoryPercent}}</code>,<br>
-prices are for on-demand nodes in {{.Region}} region
-</caption>
-<thead>
-<tr>
-	<th rowspan=2>Redis instance</th>
-	<th rowspan=2>Used, GiB</th>
-	<th rowspan=2>Peak, GiB</th>
-	<th colspan=5>Based on used memory</th>
-	<th colspan=5>Based on peak memory</th>
-</tr>
-<tr>
-	<!-- 3 columns skipped -->
-	<!-- based on used memory -->
-	<th>Node type</th>
-	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
-	<th>Load, %</th>
-	<th>USD<wbr>/hour</th>
-	<th>USD<wbr>/month</th>
-	<!-- based on peak memory -->
-	<th>Node type</th>
-	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
-	<th>Load, %</th>
-	<th>USD<wbr>/hour</th>
-	<th>USD<wbr>/month</th>
-</tr>
-</thead>
-<tbody>
-{{range .Rows}}
-<tr>
-	<td>{{.Redis.Addr}}</td><!-- instance address -->
-	<td class="right">{{printf "%.1f" .Redis.UsedGiB}}</td><!-- used memory, GiB -->
-	<td class="right">{{printf "%.1f" .Redis.PeakGiB}}</td><!-- peak memory, GiB -->
-	<!-- based on used memory -->
-	<td>{{.UsedBased.InstanceType}}</td>
-	<td class="right">{{printf "%.1f" .UsedBased.MemoryGiB}}</td>
-	<td class="right{{if ge .UsedRatio 95.0}} warn{{end}}">{{printf "%.1f" .UsedRatio}}</td>
-	<td class="right">{{printf "%.3f" .UsedBased.PricePerHour}}</td>
-	<td class="right">{{printf "%.3f" .UsedBased.PricePerMonth}}</td>
-	<!-- based on peak memory -->
-	<td>{{.PeakBased.InstanceType}}</td>
-	<td class="right">{{printf "%.1f" .PeakBased.MemoryGiB}}</td>
-	<td class="right{{if ge .PeakRatio 95.0}} warn{{end}}">{{printf "%.1f" .PeakRatio}}</td>
-	<td class="right">{{printf "%.3f" .PeakBased.PricePerHour}}</td>
-	<td class="right">{{printf "%.3f" .PeakBased.PricePerMonth}}</td>
-</tr>
-{{end}}
-</tbody>
-<tfoot>
-<tr>
-	<th scope="row" colspan=3>Totals</th>
-	<th scope="row" colspan=4>Based on used memory, USD / month</th>
-	<td class="right">{{printf "%.3f" .UsedBasedTotal}}</td>
-	<th scope="row" colspan=4>Based on peak memory, USD / month</th>
-	<td class="right">{{printf "%.3f" .PeakBasedTotal}}</td>
-</tr>
-</tfoot>
-</table>
-<footer><p id="footnote"><sup>*</sup> Node sizes displays
-<code>maxmemory</code> target Redis values, derived from
-<a href="https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.NodeSpecific">node-specific list of maxmemory values</a>, corrected to ElastiCache-specific <a href="https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.3-2-4.New"><code>reserved-memory-percent={{.ReservedMemoryPercent}}</code> parameter</a>.
-</p></footer>
-</body>
-`))
-
-//go:generate go run ./parse-maxmemory maxmemory.go
+> Redis distribution.`
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = wr
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(rd)
+		done <- b
+	}()
+	err = fn()
+	os.Stdout = stdout
+	wr.Close()
+	out := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// writeTestSnapshot writes testSnapshot to a temporary file and returns its
+// path
+func writeTestSnapshot(t *testing.T) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "snapshot.json")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := testSnapshot().Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// fakeRedis returns address of a server answering INFO command with info
+// and an error to any other command
+func fakeRedis(t *testing.T, info string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, info)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFakeRedis(conn net.Conn, info string) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		// commands are arrays of bulk strings
+		line, err := rd.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "*") {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		var cmd []string
+		for i := 0; i < n; i++ {
+			if _, err := rd.ReadString('\n'); err != nil { // $len
+				return
+			}
+			arg, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd = append(cmd, strings.TrimSpace(arg))
+		}
+		if len(cmd) != 0 && strings.EqualFold(cmd[0], "info") {
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(info), info)
+		} else {
+			fmt.Fprint(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+const testInfo = "# Memory\r\nused_memory:2147483648\r\nused_memory_peak:3221225472\r\nmaxmemory:0\r\nmaxmemory_policy:noeviction\r\n"
+
+const testLocation = "US East (N. Virginia)"
+
+func approxEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
+
+func TestReadAddresses(t *testing.T) {
+	maxLoad := 60
+	for _, tc := range []struct {
+		name, input string
+		want        []inventoryEntry
+		err         string
+	}{
+		{
+			name:  "comments and overrides",
+			input: "# comment\n\nredis-1:6379\nredis-2:6379 max-load=60 engine=valkey\n",
+			want: []inventoryEntry{
+				{Addr: "redis-1:6379"},
+				{Addr: "redis-2:6379", hostOverrides: hostOverrides{MaxLoad: &maxLoad, Engine: "valkey"}},
+			},
+		},
+		{
+			name:  "duplicate address",
+			input: "redis-1:6379\n# comment\nredis-2:6379\nredis-1:6379 max-load=60\n",
+			err:   `line 4: duplicate address "redis-1:6379", first seen on line 1`,
+		},
+		{
+			name:  "bad override",
+			input: "redis-1:6379 nodes=3\n",
+			err:   `unsupported override "nodes"`,
+		},
+		{
+			name:  "no port",
+			input: "redis-1\n",
+			err:   "missing port in address",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readAddresses(strings.NewReader(tc.input))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFitsEngine(t *testing.T) {
+	snapshot := writeTestSnapshot(t)
+	out := captureStdout(t, func() error {
+		return fitsMain([]string{"-pricing-snapshot", snapshot, "-engine", "valkey", "-json", "8GiB", "1GiB/12GiB"})
+	})
+	var rep sizing.Report
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Engine != "valkey" {
+		t.Errorf("got report engine %q, want valkey", rep.Engine)
+	}
+	if rep.HasOverrides() {
+		t.Error("got rows reported as overridden")
+	}
+	for _, row := range rep.Rows {
+		if row.Engine != "valkey" {
+			t.Errorf("%s: got engine %q, want valkey", row.Redis.Addr, row.Engine)
+		}
+	}
+	if got, want := rep.Rows[1].PeakBased.PricePerHour, 0.345; got != want {
+		t.Errorf("got peak-based price %v, want valkey price %v", got, want)
+	}
+
+	// text report has no override columns
+	out = captureStdout(t, func() error {
+		return fitsMain([]string{"-pricing-snapshot", snapshot, "-engine", "valkey", "8GiB"})
+	})
+	if strings.Contains(out, "ENGINE") {
+		t.Errorf("got override columns in text report:\n%s", out)
+	}
+}
+
+func TestRunInfoDumps(t *testing.T) {
+	args := newRunArgs()
+	args.infoDumps = filepath.Join("testdata", "info")
+	args.pricingSnapshot = filepath.Join("testdata", "snapshot.json")
+	out := captureStdout(t, func() error { return run(args) })
+	want := `HOST                USED(LOAD)   TYPE            $/HR  $/MONTH PEAK(LOAD)   TYPE            $/HR  $/MONTH 
+cache-1             2.0 (20.4%)  cache.r5.large  0.216 160.704 3.0 (30.6%)  cache.r5.large  0.216 160.704 
+cache-2             10.0 (50.7%) cache.r5.xlarge 0.431 320.664 12.0 (60.8%) cache.r5.xlarge 0.431 320.664 
+sessions (evicting) 6.0 (61.2%)  cache.r5.large  0.216 160.704 6.0 (61.2%)  cache.r5.large  0.216 160.704 
+`
+	if out != want {
+		t.Errorf("got text report\n%s\nwant\n%s", out, want)
+	}
+
+	args.json = true
+	args.groupBy = "none"
+	out = captureStdout(t, func() error { return run(args) })
+	var rep sizing.Report
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Region != testLocation || rep.Engine != sizing.DefaultEngine || rep.MaxLoad != 80 || rep.ReservedMemoryPercent != 25 {
+		t.Errorf("got report parameters %q, %q, %d, %d", rep.Region, rep.Engine, rep.MaxLoad, rep.ReservedMemoryPercent)
+	}
+	var got [][3]string
+	for _, row := range rep.Rows {
+		got = append(got, [3]string{row.Redis.Addr, row.UsedBased.InstanceType, row.PeakBased.InstanceType})
+	}
+	if want := [][3]string{
+		{"cache-1", "cache.r5.large", "cache.r5.large"},
+		{"cache-2", "cache.r5.xlarge", "cache.r5.xlarge"},
+		{"sessions", "cache.r5.large", "cache.r5.large"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+	if !rep.Rows[2].Redis.Evicting() {
+		t.Error("sessions is not reported as evicting")
+	}
+	if want := (0.216*2 + 0.431) * 24 * 31; !approxEqual(rep.UsedBasedTotal, want) {
+		t.Errorf("got used-based total %.3f, want %.3f", rep.UsedBasedTotal, want)
+	}
+	if len(rep.Groups) != 1 || rep.Groups[0].Redises != 3 {
+		t.Errorf("got groups %+v, want a single group of 3 Redis instances", rep.Groups)
+	}
+}
+
+func TestRunInventory(t *testing.T) {
+	addr := fakeRedis(t, testInfo)
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := ioutil.WriteFile(inventory, []byte(`redises:
+  - addr: `+addr+`
+    labels: {team: a}
+    engine: valkey
+    nodes: 3
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args := newRunArgs()
+	args.inventory = inventory
+	args.pricingSnapshot = filepath.Join("testdata", "snapshot.json")
+	out := captureStdout(t, func() error { return run(args) })
+	for _, want := range []string{addr + " (3 nodes)", "cache.r5.large 0.173 385.690", "valkey", "team=a"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("text report has no %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// offeringsMain prints offerings of a region with their details
+func offeringsMain(argv []string) error {
+	args := newRunArgs()
+	var engine string
+	fs := flag.NewFlagSet("offerings", flag.ExitOnError)
+	args.offeringsFlags(fs)
+	args.pricingFlags(fs)
+	fs.BoolVar(&args.csv, "csv", args.csv, "print offerings in CSV instead of formatted text")
+	fs.BoolVar(&args.json, "json", args.json, "print offerings in JSON instead of formatted text")
+	fs.StringVar(&engine, "engine", sizing.DefaultEngine, "`engine` to use prices for: redis or valkey")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s offerings:\n", progName())
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+	if args.csv && args.json {
+		return errors.New("csv and json formats are mutually exclusive")
+	}
+	if err := args.validateSizing(); err != nil {
+		return err
+	}
+	ov := hostOverrides{Engine: engine}
+	if err := ov.validate(); err != nil {
+		return err
+	}
+	region, ok := endpoints.AwsPartition().Regions()[args.region]
+	if !ok {
+		return fmt.Errorf("unsupported region %q", args.region)
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	prices, err := args.pricingProvider(sess)
+	if err != nil {
+		return err
+	}
+	_, key := ov.effective(args)
+	details, err := sizing.FetchOfferingDetails(context.Background(), prices, args.query(key, region.Description()))
+	if err != nil {
+		return err
+	}
+	switch {
+	case args.csv:
+		return writeOfferingsCSV(os.Stdout, details)
+	case args.json:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Region                string
+			Engine                string
+			ReservedMemoryPercent int
+			Offerings             []sizing.OfferingDetails
+		}{region.Description(), key.Engine, key.ResMemPct, details})
+	}
+	return writeOfferingsText(os.Stdout, details, key.ResMemPct)
+}
+
+// reservedTerms returns all reserved terms found in details, sorted the same
+// way as OfferingDetails.Reserved
+func reservedTerms(details []sizing.OfferingDetails) []sizing.ReservedPrice {
+	seen := make(map[string]bool)
+	var out []sizing.ReservedPrice
+	for _, d := range details {
+		for _, r := range d.Reserved {
+			if !seen[r.Term()] {
+				seen[r.Term()] = true
+				out = append(out, sizing.ReservedPrice{LeaseContractLength: r.LeaseContractLength, PurchaseOption: r.PurchaseOption})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LeaseContractLength == out[j].LeaseContractLength {
+			return out[i].PurchaseOption < out[j].PurchaseOption
+		}
+		return out[i].LeaseContractLength < out[j].LeaseContractLength
+	})
+	return out
+}
+
+// reservedPrice returns reserved price of d for the term of r
+func reservedPrice(d sizing.OfferingDetails, r sizing.ReservedPrice) (sizing.ReservedPrice, bool) {
+	for _, p := range d.Reserved {
+		if p.Term() == r.Term() {
+			return p, true
+		}
+	}
+	return sizing.ReservedPrice{}, false
+}
+
+func writeOfferingsText(w io.Writer, details []sizing.OfferingDetails, resMemPct int) error {
+	tw := tabwriter.NewWriter(w, 1, 4, 1, ' ', 0)
+	terms := reservedTerms(details)
+	fmt.Fprintf(tw, "TYPE\tFAMILY\tGENERATION\tVCPU\tNETWORK\tMEMORY\tMAXMEMORY\tUSABLE(%d%%)\t$/HR\t$/MONTH\t", resMemPct)
+	for _, r := range terms {
+		fmt.Fprintf(tw, "%s $/HR\t", strings.ToUpper(r.Term()))
+	}
+	fmt.Fprintln(tw)
+	var estimated bool
+	for _, d := range details {
+		generation := "current"
+		if !d.CurrentGeneration {
+			generation = "previous"
+		}
+		vcpu := "-"
+		if d.VCPU != 0 {
+			vcpu = strconv.Itoa(d.VCPU)
+		}
+		maxmemory := fmt.Sprintf("%.2f", gib(d.Maxmemory))
+		if !d.MaxmemoryKnown {
+			maxmemory += "*"
+			estimated = true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.2f\t%s\t%.2f\t%.3f\t%.3f\t", d.InstanceType, d.Family(), generation,
+			vcpu, d.NetworkPerformance, gib(d.NodeMemory), maxmemory, d.MemoryGiB(), d.PricePerHour, d.PricePerMonth())
+		for _, r := range terms {
+			if p, ok := reservedPrice(d, r); ok {
+				fmt.Fprintf(tw, "%.3f\t", p.EffectivePricePerHour())
+			} else {
+				fmt.Fprintf(tw, "-\t")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "\nMemory values are in GiB, reserved prices include upfront payment spread over the lease.")
+	if estimated {
+		fmt.Fprintln(w, "* exact maxmemory of the node type is unknown, node memory is used instead.")
+	}
+	return nil
+}
+
+func writeOfferingsCSV(w io.Writer, details []sizing.OfferingDetails) error {
+	wr := csv.NewWriter(w)
+	terms := reservedTerms(details)
+	header := []string{"instance type", "family", "current generation", "vcpu", "network performance",
+		"memory bytes", "maxmemory bytes", "maxmemory known", "usable memory bytes",
+		"price per hour", "price per month"}
+	for _, r := range terms {
+		header = append(header, r.Term()+" upfront", r.Term()+" price per hour", r.Term()+" effective price per hour")
+	}
+	if err := wr.Write(header); err != nil {
+		return err
+	}
+	for _, d := range details {
+		record := []string{d.InstanceType, d.Family(), strconv.FormatBool(d.CurrentGeneration), strconv.Itoa(d.VCPU),
+			d.NetworkPerformance, strconv.FormatUint(d.NodeMemory, 10), strconv.FormatUint(d.Maxmemory, 10),
+			strconv.FormatBool(d.MaxmemoryKnown), strconv.FormatUint(d.Memory, 10),
+			strconv.FormatFloat(d.PricePerHour, 'f', -1, 64), strconv.FormatFloat(d.PricePerMonth(), 'f', 3, 64)}
+		for _, r := range terms {
+			if p, ok := reservedPrice(d, r); ok {
+				record = append(record, strconv.FormatFloat(p.Upfront, 'f', -1, 64),
+					strconv.FormatFloat(p.PricePerHour, 'f', -1, 64),
+					strconv.FormatFloat(p.EffectivePricePerHour(), 'f', 4, 64))
+			} else {
+				record = append(record, "", "", "")
+			}
+		}
+		if err := wr.Write(record); err != nil {
+			return err
+		}
+	}
+	wr.Flush()
+	return wr.Error()
+}
+
+// gib returns bytes in GiB
+func gib(bytes uint64) float64 { return float64(bytes>>20) / 1024 }
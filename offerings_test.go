@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// addReserved adds reserved term with given upfront and hourly prices to
+// product p returned by testProduct
+func addReserved(p aws.JSONValue, lease, option, upfront, hourly string) {
+	sku := p["product"].(map[string]interface{})["sku"].(string)
+	terms := p["terms"].(map[string]interface{})
+	reserved, ok := terms["Reserved"].(map[string]interface{})
+	if !ok {
+		reserved = make(map[string]interface{})
+		terms["Reserved"] = reserved
+	}
+	code := sku + "." + lease + "." + option
+	reserved[code] = map[string]interface{}{
+		"termAttributes": map[string]interface{}{"LeaseContractLength": lease, "PurchaseOption": option},
+		"priceDimensions": map[string]interface{}{
+			code + ".upfront": map[string]interface{}{"unit": "Quantity", "pricePerUnit": map[string]interface{}{"USD": upfront}},
+			code + ".hrs":     map[string]interface{}{"unit": "Hrs", "pricePerUnit": map[string]interface{}{"USD": hourly}},
+		},
+	}
+}
+
+// writeReservedSnapshot writes testSnapshot with reserved prices of
+// cache.r5.large and cache.r5.xlarge Redis nodes to a temporary file and
+// returns its path
+func writeReservedSnapshot(t *testing.T) string {
+	t.Helper()
+	snap := testSnapshot()
+	for _, p := range snap.PriceList {
+		attrs := p["product"].(map[string]interface{})["attributes"].(map[string]interface{})
+		if attrs["cacheEngine"] != "Redis" {
+			continue
+		}
+		switch attrs["instanceType"] {
+		case "cache.r5.large":
+			addReserved(p, "1yr", "No Upfront", "0", "0.140")
+			addReserved(p, "3yr", "All Upfront", "2628", "0")
+		case "cache.r5.xlarge":
+			addReserved(p, "1yr", "No Upfront", "0", "0.280")
+		}
+	}
+	name := filepath.Join(t.TempDir(), "snapshot.json")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := snap.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestOfferingsText(t *testing.T) {
+	snapshot := writeReservedSnapshot(t)
+	out := captureStdout(t, func() error {
+		return offeringsMain([]string{"-any-family", "-any-generation", "-pricing-snapshot", snapshot})
+	})
+	want := `TYPE            FAMILY GENERATION VCPU NETWORK MEMORY MAXMEMORY USABLE(25%) $/HR  $/MONTH 1YR NO UPFRONT $/HR 3YR ALL UPFRONT $/HR 
+cache.m5.large  m5     current    -            6.38   6.38      4.79        0.156 116.064 -                   -                    
+cache.r4.large  r4     previous   -            12.30  12.29     9.22        0.228 169.632 -                   -                    
+cache.r5.large  r5     current    -            13.07  13.07     9.80        0.216 160.704 0.140               0.100                
+cache.r5.xlarge r5     current    -            26.32  26.32     19.74       0.431 320.664 0.280               -                    
+
+Memory values are in GiB, reserved prices include upfront payment spread over the lease.
+`
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestOfferingsCSV(t *testing.T) {
+	snapshot := writeReservedSnapshot(t)
+	out := captureStdout(t, func() error {
+		return offeringsMain([]string{"-any-family", "-any-generation", "-pricing-snapshot", snapshot, "-csv"})
+	})
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want header and 4 offerings:\n%s", len(records), out)
+	}
+	wantHeader := []string{"instance type", "family", "current generation", "vcpu", "network performance",
+		"memory bytes", "maxmemory bytes", "maxmemory known", "usable memory bytes",
+		"price per hour", "price per month",
+		"1yr No Upfront upfront", "1yr No Upfront price per hour", "1yr No Upfront effective price per hour",
+		"3yr All Upfront upfront", "3yr All Upfront price per hour", "3yr All Upfront effective price per hour"}
+	if !reflect.DeepEqual(records[0], wantHeader) {
+		t.Errorf("got header\n%q\nwant\n%q", records[0], wantHeader)
+	}
+	for _, tc := range []struct {
+		row  int
+		want []string // instance type, price columns
+	}{
+		{1, []string{"cache.m5.large", "0.156", "116.064", "", "", "", "", "", ""}},
+		{2, []string{"cache.r4.large", "0.228", "169.632", "", "", "", "", "", ""}},
+		{3, []string{"cache.r5.large", "0.216", "160.704", "0", "0.14", "0.1400", "2628", "0", "0.1000"}},
+		{4, []string{"cache.r5.xlarge", "0.431", "320.664", "0", "0.28", "0.2800", "", "", ""}},
+	} {
+		rec := records[tc.row]
+		if got := append([]string{rec[0]}, rec[9:]...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("row %d: got\n%q\nwant\n%q", tc.row, got, tc.want)
+		}
+	}
+}
+
+func TestOfferingsJSON(t *testing.T) {
+	snapshot := writeReservedSnapshot(t)
+	out := captureStdout(t, func() error {
+		return offeringsMain([]string{"-any-family", "-any-generation", "-pricing-snapshot", snapshot,
+			"-json", "-reserved-memory-percent", "0"})
+	})
+	var got struct {
+		Region                string
+		Engine                string
+		ReservedMemoryPercent int
+		Offerings             []sizing.OfferingDetails
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Region != testLocation || got.Engine != sizing.DefaultEngine || got.ReservedMemoryPercent != 0 {
+		t.Errorf("got parameters %q, %q, %d", got.Region, got.Engine, got.ReservedMemoryPercent)
+	}
+	var types []string
+	for _, d := range got.Offerings {
+		types = append(types, d.InstanceType)
+	}
+	if want := []string{"cache.m5.large", "cache.r4.large", "cache.r5.large", "cache.r5.xlarge"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("got offerings %v, want %v", types, want)
+	}
+	if d := got.Offerings[2]; d.Memory != d.Maxmemory || !d.MaxmemoryKnown || !d.CurrentGeneration {
+		t.Errorf("got %+v", d)
+	}
+	want := []sizing.ReservedPrice{
+		{LeaseContractLength: "1yr", PurchaseOption: "No Upfront", PricePerHour: 0.14},
+		{LeaseContractLength: "3yr", PurchaseOption: "All Upfront", Upfront: 2628},
+	}
+	if got := got.Offerings[2].Reserved; !reflect.DeepEqual(got, want) {
+		t.Errorf("got reserved prices %+v, want %+v", got, want)
+	}
+	if got := got.Offerings[0].Reserved; got != nil {
+		t.Errorf("got reserved prices %+v of offering without them", got)
+	}
+}
@@ -174,7 +174,7 @@ func nodeText(n *html.Node) string {
 
 const templateFormat = `// Code generated by parse-maxmemory; DO NOT EDIT.
 
-package main
+package sizing
 
 var maxmemoryValues = %#v
 `
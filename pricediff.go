@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// priceDiffMain matches the same Redis stats to offerings of two pricing
+// snapshots and prints how recommendations and their costs change
+func priceDiffMain(argv []string) error {
+	args := newRunArgs()
+	var reportName string
+	fs := flag.NewFlagSet("price-diff", flag.ExitOnError)
+	args.sizingFlags(fs)
+	fs.StringVar(&reportName, "report", "",
+		"`path` to JSON report to take Redis stats and per-Redis overrides from;\n"+
+			"region, max-load, reserved-memory-percent and engine default to the report ones")
+	fs.StringVar(&args.infoDumps, "info-dumps", "",
+		"`path` to directory or archive with saved INFO outputs to take Redis stats from")
+	fs.Float64Var(&args.targetHitRatio, "target-hit-ratio", args.targetHitRatio,
+		"for caches evicting keys, match offerings for memory estimated to reach this `percent` hit ratio")
+	fs.BoolVar(&args.json, "json", args.json, "print differences in JSON instead of formatted text")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s price-diff [flags] OLD-SNAPSHOT NEW-SNAPSHOT\n\n", progName())
+		fmt.Fprint(fs.Output(), priceDiffNote)
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two pricing snapshots must be given")
+	}
+	if (reportName == "") == (args.infoDumps == "") {
+		return errors.New("exactly one of JSON report or INFO dumps path must be set")
+	}
+
+	var stats []sizing.RedisStats
+	inventory := make(map[string]inventoryEntry) // keyed by address
+	if reportName != "" {
+		rep, err := readJSONReport(reportName)
+		if err != nil {
+			return err
+		}
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if err := args.reportDefaults(rep, set); err != nil {
+			return fmt.Errorf("%s: %w", reportName, err)
+		}
+		for _, row := range rep.Rows {
+			stats = append(stats, row.Redis)
+			inventory[row.Redis.Addr] = reportRowEntry(rep, row)
+		}
+	} else {
+		var err error
+		if stats, err = readInfoDumps(args.infoDumps); err != nil {
+			return err
+		}
+	}
+	if len(stats) == 0 {
+		return errors.New("no Redis stats to work on")
+	}
+	if err := args.validateSizing(); err != nil {
+		return err
+	}
+	region, ok := endpoints.AwsPartition().Regions()[args.region]
+	if !ok {
+		return fmt.Errorf("unsupported region %q", args.region)
+	}
+
+	var reports [2]sizing.Report
+	var times [2]time.Time
+	for i, name := range fs.Args() {
+		snap, err := readSnapshot(name)
+		if err != nil {
+			return err
+		}
+		offerings := make(map[offeringsKey]sizing.Offerings)
+		for _, key := range args.offeringsKeys(inventory) {
+			if offerings[key], err = fetchOfferings(context.Background(), snap, args.query(key, region.Description())); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		if reports[i], err = args.report(stats, inventory, offerings, nil, region.Description()); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		times[i] = snap.Time
+	}
+	diff, err := newPriceDiff(reports[0], reports[1])
+	if err != nil {
+		return err
+	}
+	diff.OldTime, diff.NewTime = times[0], times[1]
+	if args.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	return diff.writeText(os.Stdout)
+}
+
+const priceDiffNote = `Matches Redis stats from a JSON report or INFO dumps to offerings of two
+pricing snapshots, see snapshot subcommand, and prints Redis instances which
+recommended node types change, and how total monthly cost changes.
+
+`
+
+// readJSONReport reads report saved with -json flag
+func readJSONReport(name string) (sizing.Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return sizing.Report{}, err
+	}
+	defer f.Close()
+	var rep sizing.Report
+	if err := json.NewDecoder(f).Decode(&rep); err != nil {
+		return sizing.Report{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return rep, nil
+}
+
+// reportDefaults sets region, max-load, reserved-memory-percent, engine and
+// target-hit-ratio to the values report was made with. It fails if a flag explicitly set
+// conflicts with the report; set holds names of such flags.
+func (args *runArgs) reportDefaults(rep sizing.Report, set map[string]bool) error {
+	if rep.Region != "" {
+		region, ok := regionByDescription(rep.Region)
+		if !ok {
+			return fmt.Errorf("unsupported report region %q", rep.Region)
+		}
+		if set["region"] && args.region != region {
+			return fmt.Errorf("-region %s conflicts with report region %s (%s)", args.region, region, rep.Region)
+		}
+		args.region = region
+	}
+	if rep.MaxLoad != 0 {
+		if set["max-load"] && args.maxLoadPct != rep.MaxLoad {
+			return fmt.Errorf("-max-load %d conflicts with report max-load %d", args.maxLoadPct, rep.MaxLoad)
+		}
+		args.maxLoadPct = rep.MaxLoad
+	}
+	// zero reserved-memory-percent is valid, reports always have it set
+	if set["reserved-memory-percent"] && args.resMemPct != rep.ReservedMemoryPercent {
+		return fmt.Errorf("-reserved-memory-percent %d conflicts with report reserved-memory-percent %d",
+			args.resMemPct, rep.ReservedMemoryPercent)
+	}
+	args.resMemPct = rep.ReservedMemoryPercent
+	args.engine = reportEngine(rep)
+	// zero target-hit-ratio is omitted from reports made without it
+	if set["target-hit-ratio"] && args.targetHitRatio != rep.TargetHitRatio {
+		return fmt.Errorf("-target-hit-ratio %g conflicts with report target-hit-ratio %g",
+			args.targetHitRatio, rep.TargetHitRatio)
+	}
+	args.targetHitRatio = rep.TargetHitRatio
+	return nil
+}
+
+// regionByDescription returns code of AWS region with description, i.e.
+// us-east-1 for "US East (N. Virginia)"
+func regionByDescription(description string) (string, bool) {
+	for code, region := range endpoints.AwsPartition().Regions() {
+		if strings.EqualFold(region.Description(), description) {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// reportEngine returns engine report was made for
+func reportEngine(rep sizing.Report) string {
+	if rep.Engine == "" {
+		return sizing.DefaultEngine
+	}
+	return rep.Engine
+}
+
+// reportRowEntry returns inventory entry of report row, with overrides set for
+// row values which differ from report ones
+func reportRowEntry(rep sizing.Report, row sizing.ReportRow) inventoryEntry {
+	e := inventoryEntry{Addr: row.Redis.Addr, Labels: row.Redis.Labels, Nodes: row.Nodes}
+	if row.MaxLoad != rep.MaxLoad {
+		n := row.MaxLoad
+		e.MaxLoad = &n
+	}
+	if row.ReservedMemoryPercent != rep.ReservedMemoryPercent {
+		n := row.ReservedMemoryPercent
+		e.ReservedMemoryPercent = &n
+	}
+	if row.Engine != "" && row.Engine != reportEngine(rep) {
+		e.Engine = row.Engine
+	}
+	return e
+}
+
+// priceDiff compares recommendations for the same Redis instances under two
+// sets of prices
+type priceDiff struct {
+	OldTime, NewTime time.Time // pricing snapshots time
+	Rows             []priceDiffRow
+	Changed          int // number of rows with changed recommendations
+
+	OldUsedBasedTotal, NewUsedBasedTotal float64
+	OldPeakBasedTotal, NewPeakBasedTotal float64
+}
+
+type priceDiffRow struct {
+	Addr             string
+	UsedGiB, PeakGiB float64
+	OldUsed, NewUsed sizing.Offering
+	OldPeak, NewPeak sizing.Offering
+	Nodes            int  `json:",omitempty"` // see sizing.ReportRow.Nodes
+	Changed          bool // whether either used or peak based node type changed
+}
+
+// month returns monthly price of offering for all nodes of the row
+func (r priceDiffRow) month(o sizing.Offering) float64 {
+	if r.Nodes > 1 {
+		return o.PricePerMonth() * float64(r.Nodes)
+	}
+	return o.PricePerMonth()
+}
+
+// newPriceDiff returns diff of reports of the same Redis instances, matching
+// their rows by address
+func newPriceDiff(before, after sizing.Report) (priceDiff, error) {
+	if len(before.Rows) != len(after.Rows) {
+		return priceDiff{}, fmt.Errorf("reports have %d and %d rows", len(before.Rows), len(after.Rows))
+	}
+	afterRows := make(map[string]sizing.ReportRow, len(after.Rows))
+	for _, n := range after.Rows {
+		if _, ok := afterRows[n.Redis.Addr]; ok {
+			return priceDiff{}, fmt.Errorf("duplicate address %q in report", n.Redis.Addr)
+		}
+		afterRows[n.Redis.Addr] = n
+	}
+	d := priceDiff{
+		Rows:              make([]priceDiffRow, len(before.Rows)),
+		OldUsedBasedTotal: before.UsedBasedTotal,
+		NewUsedBasedTotal: after.UsedBasedTotal,
+		OldPeakBasedTotal: before.PeakBasedTotal,
+		NewPeakBasedTotal: after.PeakBasedTotal,
+	}
+	for i, o := range before.Rows {
+		n, ok := afterRows[o.Redis.Addr]
+		if !ok {
+			return priceDiff{}, fmt.Errorf("no %q in new report", o.Redis.Addr)
+		}
+		row := priceDiffRow{
+			Addr:    o.Redis.Addr,
+			UsedGiB: o.UsedGiB(),
+			PeakGiB: o.PeakGiB(),
+			OldUsed: o.UsedBased,
+			NewUsed: n.UsedBased,
+			OldPeak: o.PeakBased,
+			NewPeak: n.PeakBased,
+			Nodes:   o.Nodes,
+		}
+		row.Changed = o.UsedBased.InstanceType != n.UsedBased.InstanceType ||
+			o.PeakBased.InstanceType != n.PeakBased.InstanceType
+		if row.Changed {
+			d.Changed++
+		}
+		d.Rows[i] = row
+	}
+	return d, nil
+}
+
+func (d priceDiff) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "Prices as of %s compared to %s\n\n", d.NewTime.Format(time.RFC3339), d.OldTime.Format(time.RFC3339))
+	if d.Changed == 0 {
+		fmt.Fprintf(w, "None of %d Redis instances change recommended node types.\n", len(d.Rows))
+	} else {
+		tw := tabwriter.NewWriter(w, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "HOST\tUSED\tOLD TYPE\t$/MONTH\tNEW TYPE\t$/MONTH\tPEAK\tOLD TYPE\t$/MONTH\tNEW TYPE\t$/MONTH\t")
+		for _, row := range d.Rows {
+			if !row.Changed {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%.1f\t%s\t%.3f\t%s\t%.3f\t%.1f\t%s\t%.3f\t%s\t%.3f\t\n", row.Addr,
+				row.UsedGiB, row.OldUsed.InstanceType, row.month(row.OldUsed), row.NewUsed.InstanceType, row.month(row.NewUsed),
+				row.PeakGiB, row.OldPeak.InstanceType, row.month(row.OldPeak), row.NewPeak.InstanceType, row.month(row.NewPeak))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n%d of %d Redis instances change recommended node types.\n", d.Changed, len(d.Rows))
+	}
+	fmt.Fprintf(w, "Used memory based total: %s\n", costChange(d.OldUsedBasedTotal, d.NewUsedBasedTotal))
+	fmt.Fprintf(w, "Peak memory based total: %s\n", costChange(d.OldPeakBasedTotal, d.NewPeakBasedTotal))
+	return nil
+}
+
+// costChange formats change of monthly cost
+func costChange(before, after float64) string {
+	s := fmt.Sprintf("%.3f -> %.3f $/month (%+.3f", before, after, after-before)
+	if before != 0 {
+		s += fmt.Sprintf(", %+.1f%%", (after-before)/before*100)
+	}
+	return s + ")"
+}
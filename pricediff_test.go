@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+func TestReportDefaults(t *testing.T) {
+	rep := sizing.Report{Region: "Europe (Ireland)", MaxLoad: 60, ReservedMemoryPercent: 0, Engine: "valkey", TargetHitRatio: 95}
+	for _, tc := range []struct {
+		name string
+		set  map[string]bool
+		err  string
+	}{
+		{name: "defaults"},
+		{name: "same values", set: map[string]bool{"region": true, "max-load": true, "reserved-memory-percent": true, "target-hit-ratio": true}},
+		{name: "region conflict", set: map[string]bool{"region": true}, err: "-region us-east-1 conflicts with report region eu-west-1 (Europe (Ireland))"},
+		{name: "max-load conflict", set: map[string]bool{"max-load": true}, err: "-max-load 80 conflicts with report max-load 60"},
+		{
+			name: "reserved-memory-percent conflict", set: map[string]bool{"reserved-memory-percent": true},
+			err: "-reserved-memory-percent 25 conflicts with report reserved-memory-percent 0",
+		},
+		{name: "target-hit-ratio conflict", set: map[string]bool{"target-hit-ratio": true}, err: "-target-hit-ratio 0 conflicts with report target-hit-ratio 95"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := newRunArgs()
+			args.region = "us-east-1"
+			if tc.err == "" && tc.set != nil {
+				args.region, args.maxLoadPct, args.resMemPct, args.targetHitRatio = "eu-west-1", 60, 0, 95
+			}
+			err := args.reportDefaults(rep, tc.set)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args.region != "eu-west-1" || args.maxLoadPct != 60 || args.resMemPct != 0 || args.engine != "valkey" ||
+				args.targetHitRatio != 95 {
+				t.Errorf("got region %s, max-load %d, reserved-memory-percent %d, engine %s, target-hit-ratio %g",
+					args.region, args.maxLoadPct, args.resMemPct, args.engine, args.targetHitRatio)
+			}
+		})
+	}
+
+	args := newRunArgs()
+	if err := args.reportDefaults(sizing.Report{Region: "Nowhere"}, nil); err == nil {
+		t.Error("got no error of unknown report region")
+	}
+}
+
+func TestReportRowEntryEngine(t *testing.T) {
+	rep := sizing.Report{MaxLoad: 80, ReservedMemoryPercent: 25, Engine: "valkey"}
+	row := sizing.ReportRow{Redis: sizing.RedisStats{Addr: "redis:6379"}, MaxLoad: 80, ReservedMemoryPercent: 25}
+	for engine, want := range map[string]string{"valkey": "", "": "", "redis": "redis"} {
+		row.Engine = engine
+		if got := reportRowEntry(rep, row).Engine; got != want {
+			t.Errorf("row engine %q: got override %q, want %q", engine, got, want)
+		}
+	}
+}
+
+func TestNewPriceDiff(t *testing.T) {
+	row := func(addr, used string) sizing.ReportRow {
+		return sizing.ReportRow{
+			Redis:     sizing.RedisStats{Addr: addr},
+			UsedBased: sizing.Offering{InstanceType: used},
+			PeakBased: sizing.Offering{InstanceType: "cache.r5.xlarge"},
+		}
+	}
+	before := sizing.Report{Rows: []sizing.ReportRow{row("a", "cache.r5.large"), row("b", "cache.r5.large")}}
+	after := sizing.Report{Rows: []sizing.ReportRow{row("b", "cache.r6g.large"), row("a", "cache.r5.large")}}
+	d, err := newPriceDiff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Changed != 1 || d.Rows[0].Addr != "a" || d.Rows[0].Changed || d.Rows[1].NewUsed.InstanceType != "cache.r6g.large" {
+		t.Errorf("got diff %+v", d)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		after sizing.Report
+		err   string
+	}{
+		{name: "fewer rows", after: sizing.Report{Rows: after.Rows[:1]}, err: "reports have 2 and 1 rows"},
+		{name: "other address", after: sizing.Report{Rows: []sizing.ReportRow{row("a", ""), row("c", "")}}, err: `no "b" in new report`},
+		{name: "duplicate address", after: sizing.Report{Rows: []sizing.ReportRow{row("a", ""), row("a", "")}}, err: `duplicate address "a" in report`},
+	} {
+		if _, err := newPriceDiff(before, tc.after); err == nil || err.Error() != tc.err {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestPriceDiffReportEngine(t *testing.T) {
+	args := newRunArgs()
+	args.infoDumps = filepath.Join("testdata", "info")
+	args.pricingSnapshot = filepath.Join("testdata", "snapshot.json")
+	args.engine = "valkey"
+	args.maxLoadPct = 60
+	args.json = true
+	out := captureStdout(t, func() error { return run(args) })
+	var rep sizing.Report
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(t.TempDir(), "report.json")
+	if err := ioutil.WriteFile(report, []byte(out), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out = captureStdout(t, func() error {
+		return priceDiffMain([]string{"-json", "-report", report, args.pricingSnapshot, args.pricingSnapshot})
+	})
+	var diff priceDiff
+	if err := json.Unmarshal([]byte(out), &diff); err != nil {
+		t.Fatal(err)
+	}
+	// the same prices and parameters report was made with give the same totals
+	if diff.Changed != 0 || !approxEqual(diff.NewUsedBasedTotal, rep.UsedBasedTotal) || !approxEqual(diff.NewPeakBasedTotal, rep.PeakBasedTotal) {
+		t.Errorf("got %d changes and totals %.3f/%.3f, want none and report totals %.3f/%.3f", diff.Changed,
+			diff.NewUsedBasedTotal, diff.NewPeakBasedTotal, rep.UsedBasedTotal, rep.PeakBasedTotal)
+	}
+
+	err := priceDiffMain([]string{"-max-load", "80", "-report", report, args.pricingSnapshot, args.pricingSnapshot})
+	if err == nil || !strings.Contains(err.Error(), "-max-load 80 conflicts with report max-load 60") {
+		t.Errorf("got error %v, want max-load conflict", err)
+	}
+}
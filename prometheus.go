@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// promSource collects Redis memory stats from Prometheus server scraping
+// Redis instances with redis_exporter
+// (https://github.com/oliver006/redis_exporter).
+type promSource struct {
+	URL      string        // Prometheus base URL, i.e. http://localhost:9090
+	Label    string        // label identifying individual Redis instances
+	Selector string        // optional label matchers, i.e. job="redis"
+	Range    time.Duration // time range to look for historical peak over
+	Client   *http.Client  // if nil, http.DefaultClient is used
+}
+
+// stats returns memory stats of Redis instances known to Prometheus. Used
+// memory is the most recent value, peak memory is the maximum over the
+// configured time range. Evictions, keyspace hits and misses are counted over
+// the same time range.
+func (ps *promSource) stats(ctx context.Context) ([]sizing.RedisStats, error) {
+	if ps.Range < time.Minute {
+		return nil, errors.New("prometheus time range must be at least one minute")
+	}
+	sel := "{" + ps.Selector + "}"
+	rng := "[" + strconv.FormatInt(int64(ps.Range/time.Second), 10) + "s]"
+	by := "max by (" + ps.Label + ") "
+	now := time.Now()
+
+	used, err := ps.query(ctx, by+"(redis_memory_used_bytes"+sel+")", now)
+	if err != nil {
+		return nil, err
+	}
+	peak, err := ps.query(ctx, by+"(max_over_time(redis_memory_used_bytes"+sel+rng+"))", now)
+	if err != nil {
+		return nil, err
+	}
+	maxmemory, err := ps.query(ctx, by+"(redis_memory_max_bytes"+sel+")", now)
+	if err != nil {
+		return nil, err
+	}
+	sum := "sum by (" + ps.Label + ") "
+	evicted, err := ps.query(ctx, sum+"(increase(redis_evicted_keys_total"+sel+rng+"))", now)
+	if err != nil {
+		return nil, err
+	}
+	hits, err := ps.query(ctx, sum+"(increase(redis_keyspace_hits_total"+sel+rng+"))", now)
+	if err != nil {
+		return nil, err
+	}
+	misses, err := ps.query(ctx, sum+"(increase(redis_keyspace_misses_total"+sel+rng+"))", now)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sizing.RedisStats, 0, len(used))
+	for addr, usedBytes := range used {
+		st := sizing.RedisStats{
+			Addr:           addr,
+			UsedBytes:      usedBytes,
+			PeakBytes:      peak[addr],
+			MaxmemoryBytes: maxmemory[addr],
+			EvictedKeys:    evicted[addr],
+			KeyspaceHits:   hits[addr],
+			KeyspaceMisses: misses[addr],
+		}
+		if st.PeakBytes < st.UsedBytes {
+			st.PeakBytes = st.UsedBytes
+		}
+		if st.MaxmemoryBytes != 0 && st.PeakBytes >= st.MaxmemoryBytes {
+			log.Printf("%s: memory peak over the last %v reached configured maxmemory,"+
+				" actual dataset may be larger", addr, ps.Range)
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out, nil
+}
+
+// query runs Prometheus instant query, returning values keyed by the value of
+// the ps.Label label.
+func (ps *promSource) query(ctx context.Context, query string, ts time.Time) (map[string]uint64, error) {
+	u, err := url.Parse(strings.TrimSuffix(ps.URL, "/") + "/api/v1/query")
+	if err != nil {
+		return nil, err
+	}
+	vals := url.Values{}
+	vals.Set("query", query)
+	vals.Set("time", strconv.FormatInt(ts.Unix(), 10))
+	u.RawQuery = vals.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := ps.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Status    string `json:"status"`
+		Error     string `json:"error"`
+		ErrorType string `json:"errorType"`
+		Data      struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]interface{}    `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&res); err != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("prometheus query %q: status %q: %w", query, resp.Status, err)
+	}
+	if res.Status != "success" {
+		return nil, fmt.Errorf("prometheus query %q: %s: %s", query, res.ErrorType, res.Error)
+	}
+	if res.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("prometheus query %q: unexpected result type %q", query, res.Data.ResultType)
+	}
+	out := make(map[string]uint64, len(res.Data.Result))
+	for _, r := range res.Data.Result {
+		addr := r.Metric[ps.Label]
+		if addr == "" {
+			continue
+		}
+		s, ok := r.Value[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("prometheus query %q: cannot convert %T / %+v to string", query, r.Value[1], r.Value[1])
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus query %q: %w", query, err)
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+			continue
+		}
+		out[addr] = uint64(v)
+	}
+	return out, nil
+}
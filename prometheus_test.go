@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// fakePrometheus returns a server answering instant queries with vector
+// results of values keyed by instance label. Results are picked by the first
+// metric or function name of the query found in results keys.
+func fakePrometheus(t *testing.T, results map[string]map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		// more specific keys first, "max_over_time" query also has
+		// "redis_memory_used_bytes" in it
+		for _, key := range []string{"max_over_time", "redis_memory_used_bytes", "redis_memory_max_bytes",
+			"redis_evicted_keys_total", "redis_keyspace_hits_total", "redis_keyspace_misses_total"} {
+			if !strings.Contains(query, key) {
+				continue
+			}
+			var items []string
+			for instance, v := range results[key] {
+				items = append(items, fmt.Sprintf(`{"metric":{"instance":%q},"value":[1600000000,%q]}`, instance, v))
+			}
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(items, ","))
+			return
+		}
+		t.Errorf("unexpected query %q", query)
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPromSourceStats(t *testing.T) {
+	srv := fakePrometheus(t, map[string]map[string]string{
+		"redis_memory_used_bytes": {"a:6379": "100", "b:6379": "200", "c:6379": "NaN"},
+		// peak of b is below its used memory, which is then used as peak
+		"max_over_time":               {"a:6379": "150", "b:6379": "150", "c:6379": "300"},
+		"redis_memory_max_bytes":      {"a:6379": "1000", "b:6379": "+Inf"},
+		"redis_evicted_keys_total":    {"a:6379": "5.5"},
+		"redis_keyspace_hits_total":   {"a:6379": "90", "b:6379": "NaN"},
+		"redis_keyspace_misses_total": {"a:6379": "10"},
+	})
+	ps := promSource{URL: srv.URL + "/", Label: "instance", Selector: `job="redis"`, Range: time.Hour, Client: srv.Client()}
+	got, err := ps.stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sizing.RedisStats{
+		{Addr: "a:6379", UsedBytes: 100, PeakBytes: 150, MaxmemoryBytes: 1000, EvictedKeys: 5, KeyspaceHits: 90, KeyspaceMisses: 10},
+		{Addr: "b:6379", UsedBytes: 200, PeakBytes: 200},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got stats\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestPromSourceQuery(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("query")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer srv.Close()
+	ps := promSource{URL: srv.URL, Label: "instance", Selector: `job="redis"`, Range: 2 * time.Hour, Client: srv.Client()}
+	if _, err := ps.stats(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the last query is for keyspace misses
+	if want := `sum by (instance) (increase(redis_keyspace_misses_total{job="redis"}[7200s]))`; gotQuery != want {
+		t.Errorf("got query %q, want %q", gotQuery, want)
+	}
+}
+
+func TestPromSourceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{
+			name: "error status",
+			body: `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			want: "bad_data: parse error",
+		},
+		{
+			name: "matrix result",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			want: `unexpected result type "matrix"`,
+		},
+		{
+			name: "non-string value",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"instance":"a:6379"},"value":[1600000000,1]}]}}`,
+			want: "cannot convert float64",
+		},
+		{
+			name: "not JSON",
+			body: `<html>`,
+			want: "invalid character",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+			ps := promSource{URL: srv.URL, Label: "instance", Range: time.Hour, Client: srv.Client()}
+			_, err := ps.stats(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPromSourceRange(t *testing.T) {
+	ps := promSource{URL: "http://localhost:1", Label: "instance", Range: time.Second}
+	if _, err := ps.stats(context.Background()); err == nil {
+		t.Error("got no error for range under a minute")
+	}
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// rdbStats estimates how much memory Redis would use after loading RDB file.
+// The file is read sequentially and never loaded into memory as a whole.
+//
+// Estimate is based on the sizes of Redis 7 internal data structures and
+// jemalloc size classes, it is not expected to be exact, but should be close
+// enough for sizing purposes. Peak memory is the estimate, or used-mem value
+// recorded by Redis in the file at the time it was saved, whichever is larger.
+func rdbStats(name string) (sizing.RedisStats, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return sizing.RedisStats{}, err
+	}
+	defer f.Close()
+	est := newRDBEstimate()
+	if err := est.read(bufio.NewReaderSize(f, 1<<20)); err != nil {
+		return sizing.RedisStats{}, fmt.Errorf("%s: %w", name, err)
+	}
+	addr := filepath.Base(name)
+	for _, typ := range rdbTypeNames {
+		if u := est.types[typ]; u.keys != 0 {
+			log.Printf("%s: %d %s keys, estimated %.1f MiB", addr, u.keys, typ, float64(u.bytes)/(1<<20))
+		}
+	}
+	used := est.total()
+	peak := used
+	if est.usedMem > peak {
+		peak = est.usedMem
+	}
+	return sizing.RedisStats{Addr: addr, UsedBytes: used, PeakBytes: peak}, nil
+}
+
+// rdbTypeNames lists key types in the order they're reported
+var rdbTypeNames = [...]string{"string", "list", "set", "zset", "hash", "stream", "module"}
+
+type rdbEstimate struct {
+	types   map[string]*rdbTypeUsage
+	dbs     uint64 // memory used by main and expires dictionaries of all dbs
+	usedMem uint64 // value of used-mem aux field, if present
+	rd      *bufio.Reader
+}
+
+type rdbTypeUsage struct {
+	keys  uint64
+	bytes uint64
+}
+
+func newRDBEstimate() *rdbEstimate {
+	est := &rdbEstimate{types: make(map[string]*rdbTypeUsage, len(rdbTypeNames))}
+	for _, typ := range rdbTypeNames {
+		est.types[typ] = &rdbTypeUsage{}
+	}
+	return est
+}
+
+// total returns estimated used_memory value
+func (est *rdbEstimate) total() uint64 {
+	// memory used by a fresh Redis instance without any data
+	const baseOverhead = 1 << 20
+	total := baseOverhead + est.dbs
+	for _, u := range est.types {
+		total += u.bytes
+	}
+	return total
+}
+
+// RDB opcodes and object types, see rdb.h in Redis source code
+const (
+	rdbOpSlotInfo     = 0xf4
+	rdbOpFunction2    = 0xf5
+	rdbOpFunctionPre  = 0xf6
+	rdbOpModuleAux    = 0xf7
+	rdbOpIdle         = 0xf8
+	rdbOpFreq         = 0xf9
+	rdbOpAux          = 0xfa
+	rdbOpResizeDB     = 0xfb
+	rdbOpExpireTimeMs = 0xfc
+	rdbOpExpireTime   = 0xfd
+	rdbOpSelectDB     = 0xfe
+	rdbOpEOF          = 0xff
+
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZset            = 3
+	rdbTypeHash            = 4
+	rdbTypeZset2           = 5
+	rdbTypeModule2         = 7
+	rdbTypeHashZipmap      = 9
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZsetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeStreamListpacks = 15
+	rdbTypeHashListpack    = 16
+	rdbTypeZsetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeStreamListpack2 = 19
+	rdbTypeSetListpack     = 20
+	rdbTypeStreamListpack3 = 21
+)
+
+// Sizes of Redis internal structures on 64-bit platforms
+const (
+	robjSize          = 16
+	dictEntrySize     = 24
+	dictSize          = 56
+	quicklistSize     = 40
+	quicklistNodeSize = 32
+	// average size of skiplist node, given that each additional level is
+	// added with 1/4 probability
+	zskiplistNodeSize = 53
+	zskiplistSize     = 32 + 24 + 16*32 // skiplist and its header node
+	raxNodeSize       = 64              // rough size of rax node holding stream id
+	streamSize        = 64
+	streamCGroupSize  = 64
+	streamNACKSize    = 32
+	streamConsumerSz  = 64
+	listpackNodeLimit = 8 << 10 // default list-max-listpack-size of -2
+)
+
+func (est *rdbEstimate) read(rd *bufio.Reader) error {
+	est.rd = rd
+	var hdr [9]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return err
+	}
+	if string(hdr[:5]) != "REDIS" {
+		return errors.New("not an RDB file")
+	}
+	if _, err := strconv.Atoi(string(hdr[5:])); err != nil {
+		return fmt.Errorf("unsupported RDB version %q", hdr[5:])
+	}
+	var hasExpire bool
+	var dbKeys, dbExpires uint64
+	flushDB := func() {
+		est.dbs += dictTableSize(dbKeys) + dictTableSize(dbExpires)
+		dbKeys, dbExpires = 0, 0
+	}
+	for {
+		op, err := rd.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case rdbOpEOF:
+			flushDB()
+			return nil
+		case rdbOpSelectDB:
+			flushDB()
+			if _, err := est.length(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpResizeDB:
+			if _, err := est.length(); err != nil {
+				return err
+			}
+			if _, err := est.length(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpAux:
+			key, err := est.smallString()
+			if err != nil {
+				return err
+			}
+			val, err := est.smallString()
+			if err != nil {
+				return err
+			}
+			if key == "used-mem" {
+				est.usedMem, _ = strconv.ParseUint(val, 10, 64)
+			}
+			continue
+		case rdbOpExpireTime:
+			hasExpire = true
+			if err := est.skip(4); err != nil {
+				return err
+			}
+			continue
+		case rdbOpExpireTimeMs:
+			hasExpire = true
+			if err := est.skip(8); err != nil {
+				return err
+			}
+			continue
+		case rdbOpIdle:
+			if _, err := est.length(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpFreq:
+			if err := est.skip(1); err != nil {
+				return err
+			}
+			continue
+		case rdbOpSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := est.length(); err != nil {
+					return err
+				}
+			}
+			continue
+		case rdbOpFunction2:
+			if _, err := est.skipString(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpModuleAux:
+			for i := 0; i < 3; i++ { // module id, when opcode, when
+				if _, err := est.length(); err != nil {
+					return err
+				}
+			}
+			if _, err := est.skipModuleValue(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpFunctionPre:
+			return errors.New("RDB files produced by Redis 7.0 release candidates are not supported")
+		}
+		keyLen, err := est.skipString()
+		if err != nil {
+			return err
+		}
+		typ, size, err := est.value(op)
+		if err != nil {
+			return fmt.Errorf("key #%d: %w", dbKeys+1, err)
+		}
+		size += dictEntrySize + sdsSize(keyLen)
+		dbKeys++
+		if hasExpire {
+			size += dictEntrySize
+			dbExpires++
+			hasExpire = false
+		}
+		u := est.types[typ]
+		u.keys++
+		u.bytes += size
+	}
+}
+
+// value reads value of type typ and returns its type name and estimated
+// memory footprint, excluding the key.
+func (est *rdbEstimate) value(typ byte) (string, uint64, error) {
+	switch typ {
+	case rdbTypeString:
+		n, short, err := est.string(44)
+		if err != nil {
+			return "", 0, err
+		}
+		if n > 44 {
+			return "string", robjSize + sdsSize(n), nil
+		}
+		if _, err := strconv.ParseInt(string(short), 10, 64); err == nil && len(short) <= 20 {
+			return "string", robjSize, nil // integer encoded
+		}
+		return "string", mallocSize(robjSize + 3 + n + 1), nil // embstr
+	case rdbTypeList:
+		count, err := est.length()
+		if err != nil {
+			return "", 0, err
+		}
+		var packed uint64
+		for i := uint64(0); i < count; i++ {
+			n, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			packed += n + 2 // listpack entry with encoding and backlen bytes
+		}
+		nodes := packed/listpackNodeLimit + 1
+		return "list", robjSize + quicklistSize + nodes*quicklistNodeSize + mallocSize(packed), nil
+	case rdbTypeListZiplist:
+		n, err := est.skipString()
+		if err != nil {
+			return "", 0, err
+		}
+		return "list", robjSize + quicklistSize + quicklistNodeSize + mallocSize(n), nil
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		count, err := est.length()
+		if err != nil {
+			return "", 0, err
+		}
+		size := uint64(robjSize + quicklistSize)
+		for i := uint64(0); i < count; i++ {
+			if typ == rdbTypeListQuicklist2 {
+				if _, err := est.length(); err != nil { // container type
+					return "", 0, err
+				}
+			}
+			n, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			size += quicklistNodeSize + mallocSize(n)
+		}
+		return "list", size, nil
+	case rdbTypeSet:
+		count, err := est.length()
+		if err != nil {
+			return "", 0, err
+		}
+		size := robjSize + dictSize + dictTableSize(count)
+		for i := uint64(0); i < count; i++ {
+			n, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			size += dictEntrySize + sdsSize(n)
+		}
+		return "set", size, nil
+	case rdbTypeZset, rdbTypeZset2:
+		count, err := est.length()
+		if err != nil {
+			return "", 0, err
+		}
+		size := robjSize + dictSize + dictTableSize(count) + zskiplistSize
+		for i := uint64(0); i < count; i++ {
+			n, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			if err := est.skipScore(typ == rdbTypeZset2); err != nil {
+				return "", 0, err
+			}
+			size += dictEntrySize + sdsSize(n) + zskiplistNodeSize
+		}
+		return "zset", size, nil
+	case rdbTypeHash:
+		count, err := est.length()
+		if err != nil {
+			return "", 0, err
+		}
+		size := robjSize + dictSize + dictTableSize(count)
+		for i := uint64(0); i < count; i++ {
+			field, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			value, err := est.skipString()
+			if err != nil {
+				return "", 0, err
+			}
+			size += dictEntrySize + sdsSize(field) + sdsSize(value)
+		}
+		return "hash", size, nil
+	case rdbTypeSetIntset, rdbTypeSetListpack,
+		rdbTypeZsetZiplist, rdbTypeZsetListpack,
+		rdbTypeHashZipmap, rdbTypeHashZiplist, rdbTypeHashListpack:
+		// compact encodings are kept in memory as a single blob
+		n, err := est.skipString()
+		if err != nil {
+			return "", 0, err
+		}
+		name := "hash"
+		switch typ {
+		case rdbTypeSetIntset, rdbTypeSetListpack:
+			name = "set"
+		case rdbTypeZsetZiplist, rdbTypeZsetListpack:
+			name = "zset"
+		}
+		return name, robjSize + mallocSize(n), nil
+	case rdbTypeStreamListpacks, rdbTypeStreamListpack2, rdbTypeStreamListpack3:
+		size, err := est.stream(typ)
+		return "stream", size, err
+	case rdbTypeModule2:
+		if _, err := est.length(); err != nil { // module id
+			return "", 0, err
+		}
+		n, err := est.skipModuleValue()
+		return "module", robjSize + n, err
+	}
+	return "", 0, fmt.Errorf("unsupported RDB object type %d", typ)
+}
+
+func (est *rdbEstimate) stream(typ byte) (uint64, error) {
+	size := uint64(robjSize + streamSize)
+	nodes, err := est.length()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		if _, err := est.skipString(); err != nil { // master entry id
+			return 0, err
+		}
+		n, err := est.skipString()
+		if err != nil {
+			return 0, err
+		}
+		size += raxNodeSize + mallocSize(n)
+	}
+	// length, last id, and with newer versions first id, max deleted id,
+	// entries added
+	fields := 3
+	if typ >= rdbTypeStreamListpack2 {
+		fields += 5
+	}
+	for i := 0; i < fields; i++ {
+		if _, err := est.length(); err != nil {
+			return 0, err
+		}
+	}
+	groups, err := est.length()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		n, err := est.skipString() // name
+		if err != nil {
+			return 0, err
+		}
+		size += streamCGroupSize + sdsSize(n)
+		fields := 2 // last id
+		if typ >= rdbTypeStreamListpack2 {
+			fields++ // entries read
+		}
+		for i := 0; i < fields; i++ {
+			if _, err := est.length(); err != nil {
+				return 0, err
+			}
+		}
+		pel, err := est.length()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint64(0); i < pel; i++ {
+			if err := est.skip(16 + 8); err != nil { // id, delivery time
+				return 0, err
+			}
+			if _, err := est.length(); err != nil { // delivery count
+				return 0, err
+			}
+			size += streamNACKSize + raxNodeSize
+		}
+		consumers, err := est.length()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint64(0); i < consumers; i++ {
+			n, err := est.skipString() // name
+			if err != nil {
+				return 0, err
+			}
+			size += streamConsumerSz + sdsSize(n)
+			skip := uint64(8) // seen time
+			if typ >= rdbTypeStreamListpack3 {
+				skip += 8 // active time
+			}
+			if err := est.skip(skip); err != nil {
+				return 0, err
+			}
+			pel, err := est.length()
+			if err != nil {
+				return 0, err
+			}
+			if err := est.skip(pel * 16); err != nil {
+				return 0, err
+			}
+			size += pel * raxNodeSize
+		}
+	}
+	return size, nil
+}
+
+// skipModuleValue skips module-serialized value and returns its serialized
+// size.
+func (est *rdbEstimate) skipModuleValue() (uint64, error) {
+	var size uint64
+	for {
+		op, err := est.length()
+		if err != nil {
+			return 0, err
+		}
+		var n uint64
+		switch op {
+		case 0: // EOF
+			return size, nil
+		case 1, 2: // signed and unsigned integers
+			n = 8
+			_, err = est.length()
+		case 3: // float
+			n, err = 4, est.skip(4)
+		case 4: // double
+			n, err = 8, est.skip(8)
+		case 5: // string
+			n, err = est.skipString()
+		default:
+			return 0, fmt.Errorf("unsupported module value opcode %d", op)
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+}
+
+func (est *rdbEstimate) skipScore(binary bool) error {
+	if binary {
+		return est.skip(8)
+	}
+	n, err := est.rd.ReadByte()
+	if err != nil {
+		return err
+	}
+	if n >= 253 { // nan, +inf, -inf
+		return nil
+	}
+	return est.skip(uint64(n))
+}
+
+func (est *rdbEstimate) skip(n uint64) error {
+	for n > 0 {
+		chunk := n
+		if chunk > 1<<30 {
+			chunk = 1 << 30
+		}
+		if _, err := est.rd.Discard(int(chunk)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// lengthOrEncoding reads length-encoded value. If encoded is true, value is
+// a special string encoding.
+func (est *rdbEstimate) lengthOrEncoding() (val uint64, encoded bool, err error) {
+	b, err := est.rd.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		b2, err := est.rd.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(b2), false, nil
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+	var buf [8]byte
+	switch b {
+	case 0x80:
+		if _, err := io.ReadFull(est.rd, buf[:4]); err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf[:4])), false, nil
+	case 0x81:
+		if _, err := io.ReadFull(est.rd, buf[:]); err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf[:]), false, nil
+	}
+	return 0, false, fmt.Errorf("unsupported length encoding %#x", b)
+}
+
+func (est *rdbEstimate) length() (uint64, error) {
+	n, encoded, err := est.lengthOrEncoding()
+	if err == nil && encoded {
+		err = errors.New("unexpected string encoding in place of length")
+	}
+	return n, err
+}
+
+// string reads a string and returns its length. If length does not exceed
+// keep, string content is also returned.
+func (est *rdbEstimate) string(keep uint64) (uint64, []byte, error) {
+	n, encoded, err := est.lengthOrEncoding()
+	if err != nil {
+		return 0, nil, err
+	}
+	if !encoded {
+		if n > keep {
+			return n, nil, est.skip(n)
+		}
+		buf := make([]byte, n)
+		_, err := io.ReadFull(est.rd, buf)
+		return n, buf, err
+	}
+	var buf [4]byte
+	var v int64
+	switch n {
+	case 0:
+		b, err := est.rd.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		v = int64(int8(b))
+	case 1:
+		if _, err := io.ReadFull(est.rd, buf[:2]); err != nil {
+			return 0, nil, err
+		}
+		v = int64(int16(binary.LittleEndian.Uint16(buf[:2])))
+	case 2:
+		if _, err := io.ReadFull(est.rd, buf[:]); err != nil {
+			return 0, nil, err
+		}
+		v = int64(int32(binary.LittleEndian.Uint32(buf[:])))
+	case 3: // LZF-compressed, only uncompressed length is of interest
+		clen, err := est.length()
+		if err != nil {
+			return 0, nil, err
+		}
+		n, err := est.length()
+		if err != nil {
+			return 0, nil, err
+		}
+		return n, nil, est.skip(clen)
+	default:
+		return 0, nil, fmt.Errorf("unsupported string encoding %d", n)
+	}
+	s := strconv.AppendInt(nil, v, 10)
+	return uint64(len(s)), s, nil
+}
+
+func (est *rdbEstimate) skipString() (uint64, error) {
+	n, _, err := est.string(0)
+	return n, err
+}
+
+// smallString reads string no longer than 1 KiB, longer strings are skipped
+// and returned as empty.
+func (est *rdbEstimate) smallString() (string, error) {
+	_, b, err := est.string(1 << 10)
+	return string(b), err
+}
+
+// sdsSize returns memory allocated for Redis sds string of length n
+func sdsSize(n uint64) uint64 {
+	var hdr uint64
+	switch {
+	case n < 1<<5:
+		hdr = 1
+	case n < 1<<8:
+		hdr = 3
+	case n < 1<<16:
+		hdr = 5
+	case n < 1<<32:
+		hdr = 9
+	default:
+		hdr = 17
+	}
+	return mallocSize(hdr + n + 1)
+}
+
+// dictTableSize returns memory allocated for hash table buckets of
+// dictionary holding n entries.
+func dictTableSize(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return 8 << bits.Len64(n-1)
+}
+
+// mallocSize rounds n up to the nearest jemalloc size class
+func mallocSize(n uint64) uint64 {
+	switch {
+	case n <= 8:
+		return 8
+	case n <= 128:
+		return (n + 15) &^ 15
+	}
+	// four size classes per each power of two
+	spacing := uint64(1) << (bits.Len64(n-1) - 3)
+	return (n + spacing - 1) &^ (spacing - 1)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rdbBuf builds RDB byte streams
+type rdbBuf struct{ bytes.Buffer }
+
+func (b *rdbBuf) raw(p ...byte) *rdbBuf { b.Write(p); return b }
+
+// len writes length in the shortest encoding
+func (b *rdbBuf) len(n uint64) *rdbBuf {
+	switch {
+	case n < 1<<6:
+		b.WriteByte(byte(n))
+	case n < 1<<14:
+		b.WriteByte(0x40 | byte(n>>8))
+		b.WriteByte(byte(n))
+	case n < 1<<32:
+		b.WriteByte(0x80)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	default:
+		b.WriteByte(0x81)
+		binary.Write(b, binary.BigEndian, n)
+	}
+	return b
+}
+
+func (b *rdbBuf) str(s string) *rdbBuf {
+	b.len(uint64(len(s)))
+	b.WriteString(s)
+	return b
+}
+
+// blob writes string of n bytes
+func (b *rdbBuf) blob(n int) *rdbBuf { return b.str(strings.Repeat("x", n)) }
+
+func TestMallocSize(t *testing.T) {
+	for _, tc := range []struct{ n, want uint64 }{
+		{0, 8},
+		{1, 8},
+		{8, 8},
+		{9, 16},
+		{17, 32},
+		{48, 48},
+		{100, 112},
+		{128, 128},
+		{129, 160},
+		{160, 160},
+		{161, 192},
+		{257, 320},
+		{4096, 4096},
+		{4097, 5120},
+		{1<<20 + 1, 1<<20 + 1<<18},
+	} {
+		if got := mallocSize(tc.n); got != tc.want {
+			t.Errorf("mallocSize(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestSDSSize(t *testing.T) {
+	for _, tc := range []struct{ n, want uint64 }{
+		{0, 8},              // sdshdr5: 1 + 0 + 1
+		{6, 8},              // 1 + 6 + 1
+		{7, 16},             // 1 + 7 + 1
+		{31, 48},            // 1 + 31 + 1
+		{32, 48},            // sdshdr8: 3 + 32 + 1
+		{255, 320},          // 3 + 255 + 1
+		{256, 320},          // sdshdr16: 5 + 256 + 1
+		{1 << 16, 80 << 10}, // sdshdr32: 9 + 65536 + 1
+	} {
+		if got := sdsSize(tc.n); got != tc.want {
+			t.Errorf("sdsSize(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestRDBLength(t *testing.T) {
+	for _, tc := range []struct {
+		in   []byte
+		want uint64
+	}{
+		{[]byte{0x05}, 5},
+		{[]byte{0x7f, 0xff}, 1<<14 - 1},
+		{[]byte{0x80, 0x00, 0x01, 0x00, 0x00}, 1 << 16},
+		{[]byte{0x81, 0, 0, 0, 1, 0, 0, 0, 0}, 1 << 32},
+	} {
+		est := &rdbEstimate{rd: bufio.NewReader(bytes.NewReader(tc.in))}
+		got, err := est.length()
+		if err != nil {
+			t.Errorf("length of %x: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("length of %x = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+	est := &rdbEstimate{rd: bufio.NewReader(bytes.NewReader([]byte{0xc0, 0x01}))}
+	if _, err := est.length(); err == nil {
+		t.Error("got no error for string encoding in place of length")
+	}
+}
+
+func TestRDBValue(t *testing.T) {
+	// zskiplist of two members: object, dict, buckets, skiplist, and
+	// per member dict entry, sds, and skiplist node
+	const zset2 = robjSize + dictSize + 16 + zskiplistSize + 2*(dictEntrySize+8+zskiplistNodeSize)
+	// stream of one listpack node, one group with one pending entry and
+	// one consumer with one pending entry
+	const stream = robjSize + streamSize +
+		raxNodeSize + 64 + // node with 50 bytes listpack
+		streamCGroupSize + 8 + streamNACKSize + raxNodeSize +
+		streamConsumerSz + 8 + raxNodeSize
+	streamValue := func(typ byte) *rdbBuf {
+		b := new(rdbBuf)
+		b.len(1).blob(16).blob(50) // node: master id and listpack
+		fields := 3                // length, last id ms and seq
+		if typ >= rdbTypeStreamListpack2 {
+			fields += 5 // first id, max deleted id, entries added
+		}
+		for i := 0; i < fields; i++ {
+			b.len(uint64(i))
+		}
+		b.len(1).str("g") // group
+		b.len(1).len(2)   // last id
+		if typ >= rdbTypeStreamListpack2 {
+			b.len(3) // entries read
+		}
+		b.len(1).raw(make([]byte, 16+8)...).len(1) // PEL: id, delivery time and count
+		b.len(1).str("c")                          // consumer
+		b.raw(make([]byte, 8)...)                  // seen time
+		if typ >= rdbTypeStreamListpack3 {
+			b.raw(make([]byte, 8)...) // active time
+		}
+		b.len(1).raw(make([]byte, 16)...) // consumer PEL
+		return b
+	}
+	for _, tc := range []struct {
+		name  string
+		typ   byte
+		value *rdbBuf
+		want  string
+		size  uint64
+	}{
+		{"int string", rdbTypeString, new(rdbBuf).raw(0xc0, 0x7b), "string", robjSize},
+		{"int16 string", rdbTypeString, new(rdbBuf).raw(0xc1, 0x18, 0xfc), "string", robjSize},
+		{"int32 string", rdbTypeString, new(rdbBuf).raw(0xc2, 0x40, 0x42, 0x0f, 0x00), "string", robjSize},
+		{"numeric string", rdbTypeString, new(rdbBuf).str("12345"), "string", robjSize},
+		{"embstr", rdbTypeString, new(rdbBuf).str("hello"), "string", 32},            // 16 + 3 + 5 + 1
+		{"longest embstr", rdbTypeString, new(rdbBuf).blob(44), "string", 64},        // 16 + 3 + 44 + 1
+		{"raw string", rdbTypeString, new(rdbBuf).blob(45), "string", robjSize + 64}, // sds 3 + 45 + 1
+		{"lzf string", rdbTypeString, new(rdbBuf).raw(0xc3).len(10).len(100).raw(make([]byte, 10)...), "string", robjSize + 112},
+		{"listpack zset", rdbTypeZsetListpack, new(rdbBuf).blob(100), "zset", robjSize + 112},
+		{"ziplist zset", rdbTypeZsetZiplist, new(rdbBuf).blob(100), "zset", robjSize + 112},
+		{"skiplist zset", rdbTypeZset2, new(rdbBuf).len(2).str("a").raw(make([]byte, 8)...).str("bb").raw(make([]byte, 8)...), "zset", zset2},
+		{"skiplist zset with string scores", rdbTypeZset, new(rdbBuf).len(2).str("a").str("1.5").str("bb").raw(254), "zset", zset2},
+		{"hash", rdbTypeHash, new(rdbBuf).len(1).str("f").str("v"), "hash", robjSize + dictSize + 8 + dictEntrySize + 8 + 8},
+		{"listpack hash", rdbTypeHashListpack, new(rdbBuf).blob(20), "hash", robjSize + 32},
+		{"intset", rdbTypeSetIntset, new(rdbBuf).blob(20), "set", robjSize + 32},
+		{"set", rdbTypeSet, new(rdbBuf).len(3).str("a").str("b").str("c"), "set", robjSize + dictSize + 32 + 3*(dictEntrySize+8)},
+		{"quicklist", rdbTypeListQuicklist2, new(rdbBuf).len(2).len(2).blob(100).len(2).blob(20), "list", robjSize + quicklistSize + 2*quicklistNodeSize + 112 + 32},
+		// stream versions only differ in fields, not in memory footprint
+		{"stream", rdbTypeStreamListpacks, streamValue(rdbTypeStreamListpacks), "stream", stream},
+		{"stream v2", rdbTypeStreamListpack2, streamValue(rdbTypeStreamListpack2), "stream", stream},
+		{"stream v3", rdbTypeStreamListpack3, streamValue(rdbTypeStreamListpack3), "stream", stream},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rd := bufio.NewReader(bytes.NewReader(tc.value.Bytes()))
+			est := &rdbEstimate{rd: rd}
+			name, size, err := est.value(tc.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.want || size != tc.size {
+				t.Errorf("got %s of %d bytes, want %s of %d bytes", name, size, tc.want, tc.size)
+			}
+			if n, _ := rd.Discard(1 << 10); n != 0 {
+				t.Errorf("%d bytes left unread", n)
+			}
+		})
+	}
+}
+
+// testRDB returns RDB file with aux fields, two databases, keys with expiry,
+// idle and frequency opcodes, and the offset of its EOF opcode
+func testRDB() ([]byte, int) {
+	b := new(rdbBuf)
+	b.WriteString("REDIS0011")
+	b.raw(rdbOpAux).str("redis-ver").str("7.2.4")
+	b.raw(rdbOpAux).str("used-mem").str("4000000")
+	b.raw(rdbOpAux).str("aof-base").raw(0xc0, 0x00) // int-encoded aux value
+	b.raw(rdbOpSelectDB).len(0)
+	b.raw(rdbOpResizeDB).len(2).len(1)
+	b.raw(rdbOpExpireTimeMs).raw(make([]byte, 8)...)
+	b.raw(rdbTypeString).str("k1").str("hello")
+	b.raw(rdbOpIdle).len(100)
+	b.raw(rdbTypeHashListpack).str("k2").blob(20)
+	b.raw(rdbOpSelectDB).len(1)
+	b.raw(rdbOpResizeDB).len(1).len(1)
+	b.raw(rdbOpExpireTime).raw(make([]byte, 4)...)
+	b.raw(rdbOpFreq).raw(5)
+	b.raw(rdbTypeString).str("k3").raw(0xc0, 0x01)
+	eof := b.Len()
+	b.raw(rdbOpEOF).raw(make([]byte, 8)...) // checksum
+	return b.Bytes(), eof
+}
+
+func TestRDBEstimate(t *testing.T) {
+	data, _ := testRDB()
+	est := newRDBEstimate()
+	if err := est.read(bufio.NewReader(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if est.usedMem != 4000000 {
+		t.Errorf("got used-mem %d, want 4000000", est.usedMem)
+	}
+	key := uint64(dictEntrySize + 8) // dict entry and sds of 2 bytes key
+	for typ, want := range map[string]rdbTypeUsage{
+		// embstr and int with expiry
+		"string": {keys: 2, bytes: key + 32 + dictEntrySize + key + robjSize + dictEntrySize},
+		"hash":   {keys: 1, bytes: key + robjSize + 32},
+	} {
+		if got := *est.types[typ]; got != want {
+			t.Errorf("got %s usage %+v, want %+v", typ, got, want)
+		}
+	}
+	// db 0: two keys, one expire; db 1: one key, one expire
+	if want := uint64(16 + 8 + 8 + 8); est.dbs != want {
+		t.Errorf("got dbs size %d, want %d", est.dbs, want)
+	}
+
+	name := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := ioutil.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	st, err := rdbStats(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Addr != "dump.rdb" || st.UsedBytes != est.total() || st.PeakBytes != 4000000 {
+		t.Errorf("got stats %+v, want used %d and peak 4000000", st, est.total())
+	}
+}
+
+func TestRDBErrors(t *testing.T) {
+	data, eof := testRDB()
+	// any file cut before EOF opcode is an error
+	for i := 0; i < eof; i++ {
+		err := newRDBEstimate().read(bufio.NewReader(bytes.NewReader(data[:i])))
+		if err == nil {
+			t.Errorf("got no error for file truncated to %d of %d bytes", i, len(data))
+		} else if i > 9 && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("file truncated to %d bytes: got error %v, want EOF", i, err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not RDB", []byte("PK\x03\x04000000"), "not an RDB file"},
+		{"bad version", []byte("REDIS00x1\xff"), "unsupported RDB version"},
+		{"7.0 release candidate", []byte("REDIS0010\xf6"), "release candidates"},
+		{"unknown type", []byte("REDIS0011\x06\x01k\x00"), "key #1: unsupported RDB object type 6"},
+		{"unknown string encoding", []byte("REDIS0011\x00\x01k\xc4"), "unsupported string encoding 4"},
+	} {
+		err := newRDBEstimate().read(bufio.NewReader(bytes.NewReader(tc.data)))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want one containing %q", tc.name, err, tc.want)
+		}
+	}
+	if _, err := rdbStats(filepath.Join(t.TempDir(), "missing.rdb")); !os.IsNotExist(err) {
+		t.Errorf("got error %v for missing file", err)
+	}
+}
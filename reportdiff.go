@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+// reportDiffMain compares two JSON reports of the same fleet
+func reportDiffMain(argv []string) error {
+	var threshold float64 = 10
+	var markdown bool
+	var html string
+	fs := flag.NewFlagSet("report-diff", flag.ExitOnError)
+	fs.Float64Var(&threshold, "growth", threshold,
+		"report Redis instances which used or peak memory grew by more than this `percent`")
+	fs.BoolVar(&markdown, "markdown", markdown, "print differences in Markdown instead of formatted text")
+	fs.StringVar(&html, "html", html, "`path` to HTML file to save differences to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report-diff [flags] OLD-REPORT NEW-REPORT\n\n", progName())
+		fmt.Fprint(fs.Output(), reportDiffNote)
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two JSON reports must be given")
+	}
+	if threshold < 0 {
+		return errors.New("memory growth threshold cannot be negative")
+	}
+	if markdown && html != "" {
+		return errors.New("markdown and html formats are mutually exclusive")
+	}
+	before, err := readJSONReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := readJSONReport(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := newReportDiff(before, after, threshold)
+	switch {
+	case markdown:
+		return d.writeMarkdown(os.Stdout)
+	case html != "":
+		buf := new(bytes.Buffer)
+		if err := reportDiffTemplate.Execute(buf, d); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(html, buf.Bytes(), 0666)
+	}
+	return d.writeText(os.Stdout)
+}
+
+const reportDiffNote = `Compares two JSON reports, i.e. of weekly runs, and prints Redis instances
+added and removed, ones which memory grew by more than -growth percent, ones
+with changed recommendations, and how total monthly cost changes.
+
+`
+
+// reportDiff holds differences between two reports, Redis instances are
+// matched by address
+type reportDiff struct {
+	OldTime, NewTime time.Time
+	Threshold        float64 // memory growth percent
+
+	Added   []sizing.ReportRow
+	Removed []sizing.ReportRow
+	Grown   []reportDiffRow // used or peak memory grew over Threshold
+	Changed []reportDiffRow // used or peak based node type changed
+
+	OldUsedBasedTotal, NewUsedBasedTotal float64
+	OldPeakBasedTotal, NewPeakBasedTotal float64
+}
+
+type reportDiffRow struct {
+	Old, New sizing.ReportRow
+}
+
+// UsedGrowth returns percent of used memory growth
+func (r reportDiffRow) UsedGrowth() float64 {
+	return growth(r.Old.Redis.UsedBytes, r.New.Redis.UsedBytes)
+}
+
+// PeakGrowth returns percent of peak memory growth
+func (r reportDiffRow) PeakGrowth() float64 {
+	return growth(r.Old.Redis.PeakBytes, r.New.Redis.PeakBytes)
+}
+
+// growth returns percent of growth from before to after, +Inf if before is
+// zero and after is not
+func growth(before, after uint64) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (float64(after) - float64(before)) / float64(before) * 100
+}
+
+func newReportDiff(before, after sizing.Report, threshold float64) reportDiff {
+	d := reportDiff{
+		OldTime:           before.Time,
+		NewTime:           after.Time,
+		Threshold:         threshold,
+		OldUsedBasedTotal: before.UsedBasedTotal,
+		NewUsedBasedTotal: after.UsedBasedTotal,
+		OldPeakBasedTotal: before.PeakBasedTotal,
+		NewPeakBasedTotal: after.PeakBasedTotal,
+	}
+	oldRows := make(map[string]sizing.ReportRow, len(before.Rows))
+	for _, row := range before.Rows {
+		oldRows[row.Redis.Addr] = row
+	}
+	newRows := make(map[string]struct{}, len(after.Rows))
+	for _, row := range after.Rows {
+		newRows[row.Redis.Addr] = struct{}{}
+		o, ok := oldRows[row.Redis.Addr]
+		if !ok {
+			d.Added = append(d.Added, row)
+			continue
+		}
+		r := reportDiffRow{Old: o, New: row}
+		if r.UsedGrowth() > threshold || r.PeakGrowth() > threshold {
+			d.Grown = append(d.Grown, r)
+		}
+		if o.UsedBased.InstanceType != row.UsedBased.InstanceType || o.PeakBased.InstanceType != row.PeakBased.InstanceType {
+			d.Changed = append(d.Changed, r)
+		}
+	}
+	for _, row := range before.Rows {
+		if _, ok := newRows[row.Redis.Addr]; !ok {
+			d.Removed = append(d.Removed, row)
+		}
+	}
+	return d
+}
+
+// diffTable is a single section of report diff
+type diffTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Tables returns report diff sections, sections without rows are included
+func (d reportDiff) Tables() []diffTable {
+	rowsTable := func(title string, rows []sizing.ReportRow) diffTable {
+		t := diffTable{Title: title, Header: []string{"Host", "Used GiB", "Type", "$/month", "Peak GiB", "Type", "$/month"}}
+		for _, row := range rows {
+			t.Rows = append(t.Rows, []string{row.Redis.Addr,
+				fmt.Sprintf("%.1f", row.UsedGiB()), row.UsedBased.InstanceType, fmt.Sprintf("%.3f", row.UsedPricePerMonth()),
+				fmt.Sprintf("%.1f", row.PeakGiB()), row.PeakBased.InstanceType, fmt.Sprintf("%.3f", row.PeakPricePerMonth())})
+		}
+		return t
+	}
+	grown := diffTable{
+		Title:  fmt.Sprintf("Memory grew by more than %g%%", d.Threshold),
+		Header: []string{"Host", "Old used GiB", "New used GiB", "Growth", "Old peak GiB", "New peak GiB", "Growth"},
+	}
+	for _, r := range d.Grown {
+		grown.Rows = append(grown.Rows, []string{r.New.Redis.Addr,
+			fmt.Sprintf("%.1f", r.Old.Redis.UsedGiB()), fmt.Sprintf("%.1f", r.New.Redis.UsedGiB()), formatGrowth(r.UsedGrowth()),
+			fmt.Sprintf("%.1f", r.Old.Redis.PeakGiB()), fmt.Sprintf("%.1f", r.New.Redis.PeakGiB()), formatGrowth(r.PeakGrowth())})
+	}
+	changed := diffTable{
+		Title:  "Changed recommendations",
+		Header: []string{"Host", "Old used type", "New used type", "$/month change", "Old peak type", "New peak type", "$/month change"},
+	}
+	for _, r := range d.Changed {
+		changed.Rows = append(changed.Rows, []string{r.New.Redis.Addr,
+			r.Old.UsedBased.InstanceType, r.New.UsedBased.InstanceType,
+			fmt.Sprintf("%+.3f", r.New.UsedPricePerMonth()-r.Old.UsedPricePerMonth()),
+			r.Old.PeakBased.InstanceType, r.New.PeakBased.InstanceType,
+			fmt.Sprintf("%+.3f", r.New.PeakPricePerMonth()-r.Old.PeakPricePerMonth())})
+	}
+	return []diffTable{
+		rowsTable("New Redis instances", d.Added),
+		rowsTable("Removed Redis instances", d.Removed),
+		grown,
+		changed,
+	}
+}
+
+// formatGrowth formats percent of growth, "new data" for growth from zero
+func formatGrowth(pct float64) string {
+	if math.IsInf(pct, 1) {
+		return "new data"
+	}
+	return fmt.Sprintf("%+.1f%%", pct)
+}
+
+// Totals returns lines describing total cost change
+func (d reportDiff) Totals() []string {
+	return []string{
+		"Used memory based total: " + costChange(d.OldUsedBasedTotal, d.NewUsedBasedTotal),
+		"Peak memory based total: " + costChange(d.OldPeakBasedTotal, d.NewPeakBasedTotal),
+	}
+}
+
+// Period returns times of compared reports
+func (d reportDiff) Period() string {
+	return fmt.Sprintf("Report of %s compared to report of %s", d.NewTime.Format(time.RFC3339), d.OldTime.Format(time.RFC3339))
+}
+
+func (d reportDiff) writeText(w io.Writer) error {
+	fmt.Fprintln(w, d.Period())
+	for _, t := range d.Tables() {
+		fmt.Fprintf(w, "\n%s:\n", t.Title)
+		if len(t.Rows) == 0 {
+			fmt.Fprintln(w, "none")
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 1, 4, 1, ' ', 0)
+		fmt.Fprintf(tw, "%s\t\n", strings.ToUpper(strings.Join(t.Header, "\t")))
+		for _, row := range t.Rows {
+			fmt.Fprintf(tw, "%s\t\n", strings.Join(row, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w)
+	for _, s := range d.Totals() {
+		fmt.Fprintln(w, s)
+	}
+	return nil
+}
+
+func (d reportDiff) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "%s.\n", d.Period())
+	cell := strings.NewReplacer("|", `\|`).Replace
+	for _, t := range d.Tables() {
+		fmt.Fprintf(w, "\n### %s\n\n", t.Title)
+		if len(t.Rows) == 0 {
+			fmt.Fprintln(w, "None.")
+			continue
+		}
+		fmt.Fprintf(w, "| %s |\n|%s\n", strings.Join(t.Header, " | "), strings.Repeat(" --- |", len(t.Header)))
+		for _, row := range t.Rows {
+			cells := make([]string, len(row))
+			for i, c := range row {
+				cells[i] = cell(c)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+	fmt.Fprintf(w, "\n### Totals\n\n")
+	for _, s := range d.Totals() {
+		fmt.Fprintf(w, "- %s\n", s)
+	}
+	return nil
+}
+
+var reportDiffTemplate = template.Must(template.New("diff").Parse(`<!doctype html><head><meta charset="utf-8">
+<title>Changes of Redis instances matched to ElastiCache Redis instances</title>
+<style>
+	html {line-height: 1.3; font-family: ui-serif, serif;}
+	table, code {font-family: ui-monospace, monospace;}
+	caption {padding:1em; caption-side: top; font-weight: bold; font-family: ui-sans-serif, sans-serif;}
+	th, td {padding: 0.1rem .5rem;}
+	td {white-space: nowrap;}
+	th {vertical-align: middle; text-align: center; background-color: #eee;}
+	tr:nth-child(even) td {background-color: #f8f8f8;}
+	tr:hover td {background-color: #eee;}
+</style>
+</head>
+<body>
+<p>{{.Period}}.</p>
+{{range .Tables}}
+<table>
+<caption>{{.Title}}</caption>
+{{if .Rows}}<thead><tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>{{else}}<tbody><tr><td>None.</td></tr></tbody>{{end}}
+</table>
+{{end}}
+<ul>{{range .Totals}}
+	<li>{{.}}</li>{{end}}
+</ul>
+</body>
+`))
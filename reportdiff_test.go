@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+func TestGrowth(t *testing.T) {
+	for _, tc := range []struct {
+		before, after uint64
+		want          float64
+		text          string
+	}{
+		{100, 150, 50, "+50.0%"},
+		{100, 80, -20, "-20.0%"},
+		{0, 0, 0, "+0.0%"},
+		{0, 10, math.Inf(1), "new data"},
+	} {
+		got := growth(tc.before, tc.after)
+		if got != tc.want {
+			t.Errorf("growth(%d, %d): got %v, want %v", tc.before, tc.after, got, tc.want)
+		}
+		if text := formatGrowth(got); text != tc.text {
+			t.Errorf("growth(%d, %d): got %q, want %q", tc.before, tc.after, text, tc.text)
+		}
+	}
+}
+
+func TestReportDiffGrowthFromZero(t *testing.T) {
+	row := func(used, peak uint64) sizing.ReportRow {
+		return sizing.ReportRow{Redis: sizing.RedisStats{Addr: "redis:6379", UsedBytes: used, PeakBytes: peak}}
+	}
+	const gib = 1 << 30
+	d := newReportDiff(
+		sizing.Report{Rows: []sizing.ReportRow{row(0, gib)}},
+		sizing.Report{Rows: []sizing.ReportRow{row(gib, gib)}}, 10)
+	if len(d.Grown) != 1 {
+		t.Fatalf("got %d grown rows, want Redis with data added to empty one", len(d.Grown))
+	}
+	grown := d.Tables()[2]
+	if got := grown.Rows[0][3]; got != "new data" {
+		t.Errorf("got used growth %q, want new data", got)
+	}
+	if got := grown.Rows[0][6]; got != "+0.0%" {
+		t.Errorf("got peak growth %q, want +0.0%%", got)
+	}
+}
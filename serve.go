@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func serveMain(argv []string) error {
+	args := serveArgs{
+		addr:     "localhost:8080",
+		refresh:  24 * time.Hour,
+		defaults: newRunArgs(),
+	}
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&args.addr, "addr", args.addr, "`address` to listen at")
+	fs.BoolVar(&args.allowRemote, "allow-remote", false,
+		"allow listening at non-loopback address; /report makes server connect to addresses given in requests")
+	fs.DurationVar(&args.refresh, "refresh", args.refresh,
+		"refetch cached offerings once they are older than this `interval`")
+	fs.StringVar(&args.defaults.region, "region", args.defaults.region,
+		"AWS `region` to use prices for if request has no region parameter")
+	fs.IntVar(&args.defaults.maxLoadPct, "max-load", args.defaults.maxLoadPct,
+		"max-load `percent` to use if request has no max-load parameter")
+	fs.StringVar(&args.defaults.pricingSnapshot, "pricing-snapshot", "",
+		"`path` to pricing snapshot file to use prices from instead of AWS Price List API")
+	fs.StringVar(&args.defaults.bulkPrices, "bulk-prices", "",
+		"`source` of AWS bulk price list offer file to use prices from instead of AWS Price List API,\n"+
+			"either URL or path, {region} is replaced with region code; \"aws\" for the public AWS offer file")
+	fs.IntVar(&args.defaults.resMemPct, "reserved-memory-percent", args.defaults.resMemPct,
+		"reserved-memory-percent `value` to use if request has no reserved-memory-percent parameter")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s serve:\n", progName())
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), serveNote)
+	}
+	fs.Parse(argv)
+	if args.refresh <= 0 {
+		return errors.New("refresh interval must be positive")
+	}
+	if err := checkListenAddr(args.addr, args.allowRemote); err != nil {
+		return err
+	}
+	if err := args.defaults.validateSizing(); err != nil {
+		return err
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	prices, err := args.defaults.pricingProvider(sess)
+	if err != nil {
+		return err
+	}
+	srv := &server{
+		defaults: args.defaults,
+		cache: &offeringsCache{
+			prices:  prices,
+			ttl:     args.refresh,
+			entries: make(map[sizing.OfferingsQuery]*cachedOfferings),
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/offerings", srv.handleOfferings)
+	mux.HandleFunc("/match", srv.handleMatch)
+	mux.HandleFunc("/report", srv.handleReport)
+	hs := &http.Server{
+		Addr:              args.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("serving at %s", args.addr)
+	return hs.ListenAndServe()
+}
+
+type serveArgs struct {
+	addr        string
+	allowRemote bool
+	refresh     time.Duration
+	defaults    runArgs // defaults for request parameters
+}
+
+// checkListenAddr returns an error if addr is not a loopback address and
+// allowRemote is false, since /report lets anyone who can reach the server
+// make it connect to arbitrary addresses
+func checkListenAddr(addr string, allowRemote bool) error {
+	if allowRemote {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %w", err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen at non-loopback address %q without -allow-remote", addr)
+}
+
+const serveNote = `
+Endpoints:
+
+GET /offerings        lists offerings sorted by memory
+GET /match?size=37GiB matches offering to the given memory size
+POST /report          connects to Redis instances listed in request body,
+                      which uses -inventory file format, and returns report;
+                      format parameter selects json (default), html, csv,
+                      text, markdown, or xlsx report format
+
+Query parameters are named after command line flags of the default mode:
+region, engine, max-load, reserved-memory-percent, any-family, any-generation,
+include-type, exclude-type, prefer-family, prefer-tolerance, smallest-fit,
+candidates, target-hit-ratio, group-by.
+`
+
+// server serves HTTP API, see serveNote
+type server struct {
+	defaults runArgs
+	cache    *offeringsCache
+}
+
+func (srv *server) handleOfferings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	args, engine, location, err := srv.requestArgs(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := offeringsKey{Engine: engine, ResMemPct: args.resMemPct}
+	ofs, err := srv.cache.get(r.Context(), args.query(key, location))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, struct {
+		Region                string
+		Engine                string
+		ReservedMemoryPercent int
+		Offerings             sizing.Offerings
+	}{location, engine, args.resMemPct, ofs})
+}
+
+func (srv *server) handleMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("size") == "" {
+		http.Error(w, "size parameter is required", http.StatusBadRequest)
+		return
+	}
+	size, err := parseSize(q.Get("size"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	args, engine, location, err := srv.requestArgs(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := offeringsKey{Engine: engine, ResMemPct: args.resMemPct}
+	ofs, err := srv.cache.get(r.Context(), args.query(key, location))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	o, err := ofs.Match(size, args.maxLoadPct, args.policy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, struct {
+		Region                string
+		Engine                string
+		Size                  uint64
+		MaxLoad               int
+		ReservedMemoryPercent int
+		Match                 sizing.Offering
+		Load                  float64            // percent of matched offering memory used
+		Candidates            []sizing.Candidate `json:",omitempty"`
+	}{
+		Region:                location,
+		Engine:                engine,
+		Size:                  size,
+		MaxLoad:               args.maxLoadPct,
+		ReservedMemoryPercent: args.resMemPct,
+		Match:                 o,
+		Load:                  float64(size) / float64(o.Memory) * 100,
+		Candidates:            ofs.Candidates(size, args.maxLoadPct, args.policy, args.candidates),
+	})
+}
+
+// maxReportBody is the maximum size of /report request body
+const maxReportBody = 1 << 20
+
+func (srv *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var ofs sizing.Offerings // default offerings, set once fetched
+	write := sizing.WriteJSON
+	contentType := "application/json"
+	switch q.Get("format") {
+	case "", "json":
+	case "html":
+		write, contentType = sizing.WriteHTML, "text/html; charset=utf-8"
+	case "csv":
+		write, contentType = sizing.WriteCSV, "text/csv; charset=utf-8"
+	case "text":
+		write, contentType = sizing.WriteText, "text/plain; charset=utf-8"
+	case "markdown":
+		write, contentType = sizing.WriteMarkdown, "text/markdown; charset=utf-8"
+	case "xlsx":
+		write = func(w io.Writer, rep sizing.Report) error { return sizing.WriteXLSX(w, rep, ofs) }
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		http.Error(w, "format must be one of json, html, csv, text, markdown, xlsx", http.StatusBadRequest)
+		return
+	}
+	args, _, location, err := srv.requestArgs(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReportBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := parseInventory(b, "request body")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "no Redis addresses to work on", http.StatusBadRequest)
+		return
+	}
+	endpoints := make([]sizing.Endpoint, len(entries))
+	inventory := make(map[string]inventoryEntry, len(entries)) // keyed by address
+	for i, e := range entries {
+		// passwords would be read from server environment or files and sent
+		// to addresses of the caller's choosing
+		if e.PasswordEnv != "" || e.PasswordFile != "" {
+			http.Error(w, e.Addr+": password-env and password-file are not supported in requests", http.StatusBadRequest)
+			return
+		}
+		endpoints[i] = sizing.Endpoint{Addr: e.Addr, Username: e.Username, TLS: e.TLS}
+		inventory[e.Addr] = e
+	}
+	offerings := make(map[offeringsKey]sizing.Offerings)
+	keys := args.offeringsKeys(inventory)
+	for _, key := range keys {
+		if offerings[key], err = srv.cache.get(r.Context(), args.query(key, location)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	ofs = offerings[keys[0]]
+	stats, err := sizing.EndpointStats(r.Context(), endpoints, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rep, err := args.report(stats, inventory, offerings, nil, location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := write(buf, rep); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// requestArgs returns server defaults with values overridden by query
+// parameters, named after corresponding command line flags. It also returns
+// engine and AWS price list location of requested region.
+func (srv *server) requestArgs(q url.Values) (args runArgs, engine, location string, err error) {
+	args, engine = srv.defaults, sizing.DefaultEngine
+	for name, values := range q {
+		v := values[len(values)-1]
+		var err error
+		switch name {
+		case "region":
+			args.region = v
+		case "engine":
+			engine = strings.ToLower(v)
+		case "max-load":
+			args.maxLoadPct, err = strconv.Atoi(v)
+		case "reserved-memory-percent":
+			args.resMemPct, err = strconv.Atoi(v)
+		case "any-family":
+			args.anyFamily, err = strconv.ParseBool(v)
+		case "any-generation":
+			args.withOldGen, err = strconv.ParseBool(v)
+		case "include-type":
+			args.policy.Include = values
+		case "exclude-type":
+			args.policy.Exclude = values
+		case "prefer-family":
+			args.policy.Prefer = values
+		case "prefer-tolerance":
+			args.policy.Tolerance, err = strconv.ParseFloat(v, 64)
+		case "smallest-fit":
+			args.policy.SmallestFit, err = strconv.ParseBool(v)
+		case "candidates":
+			args.candidates, err = strconv.Atoi(v)
+		case "target-hit-ratio":
+			args.targetHitRatio, err = strconv.ParseFloat(v, 64)
+		case "group-by":
+			args.groupBy = v
+		case "size", "format": // endpoint-specific
+		default:
+			return args, "", "", fmt.Errorf("unsupported parameter %q", name)
+		}
+		if err != nil {
+			return args, "", "", fmt.Errorf("invalid %s value %q", name, v)
+		}
+	}
+	if err := (hostOverrides{Engine: engine}).validate(); err != nil {
+		return args, "", "", err
+	}
+	args.engine = engine
+	if err := args.validateSizing(); err != nil {
+		return args, "", "", err
+	}
+	region, ok := endpoints.AwsPartition().Regions()[args.region]
+	if !ok {
+		return args, "", "", fmt.Errorf("unsupported region %q", args.region)
+	}
+	return args, engine, region.Description(), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+// offeringsCache caches offerings fetched from pricing provider, fetching
+// them again once they're older than ttl
+type offeringsCache struct {
+	prices sizing.Provider
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[sizing.OfferingsQuery]*cachedOfferings
+}
+
+type cachedOfferings struct {
+	mu      sync.Mutex // held while fetching
+	fetched time.Time
+	ofs     sizing.Offerings
+}
+
+// get returns cached offerings for query, fetching them if they're missing
+// or stale. If refetch of stale offerings fails, they are returned as is.
+func (c *offeringsCache) get(ctx context.Context, q sizing.OfferingsQuery) (sizing.Offerings, error) {
+	c.mu.Lock()
+	e, ok := c.entries[q]
+	if !ok {
+		e = new(cachedOfferings)
+		c.entries[q] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.fetched.IsZero() && time.Since(e.fetched) < c.ttl {
+		return e.ofs, nil
+	}
+	ofs, err := fetchOfferings(ctx, c.prices, q)
+	if err != nil {
+		if !e.fetched.IsZero() {
+			log.Printf("refreshing %s offerings in %s: %v, using ones fetched at %s",
+				q.Engine, q.Location, err, e.fetched.Format(time.RFC3339))
+			return e.ofs, nil
+		}
+		return nil, err
+	}
+	e.ofs, e.fetched = ofs, time.Now()
+	return ofs, nil
+}
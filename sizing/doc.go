@@ -0,0 +1,10 @@
+// Package sizing matches Redis instances to AWS ElastiCache node types by
+// their memory usage.
+//
+// Typical use is to fetch offerings with FetchOfferings from a Provider, i.e.
+// AWS Price List API returned by NewAPIProvider or a saved Snapshot, collect
+// Redis memory stats with LiveStats, EndpointStats or ParseInfo, match each
+// Redis to offerings with NewReportRow, and combine rows with NewReport, which
+// can be written with WriteText, WriteCSV, WriteJSON, WriteMarkdown,
+// WriteHTML, or WriteXLSX.
+package sizing
@@ -0,0 +1,148 @@
+package sizing
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// KeyspaceScan configures deep scan of Redis keyspace: keys are iterated with
+// SCAN, memory usage of a random sample of them is measured with MEMORY USAGE,
+// and the results are aggregated by key prefix.
+type KeyspaceScan struct {
+	Rate      int     // max number of keys to scan per second
+	Sample    float64 // fraction of keys to measure memory usage of, (0,1]
+	Delimiter string  // prefix is the part of the key before the first delimiter
+	Top       int     // number of top prefixes by memory usage to keep
+}
+
+// Validate checks scan settings are within allowed ranges
+func (ks *KeyspaceScan) Validate() error {
+	if ks.Rate < 1 {
+		return errors.New("scan rate must be positive")
+	}
+	if ks.Sample <= 0 || ks.Sample > 1 {
+		return errors.New("scan sample must be in (0,1] range")
+	}
+	if ks.Delimiter == "" {
+		return errors.New("prefix delimiter cannot be empty")
+	}
+	if ks.Top < 1 {
+		return errors.New("number of top prefixes must be positive")
+	}
+	return nil
+}
+
+// interval returns how long to wait between scans of batch keys to maintain
+// the rate. It is at least 1ns, as rates too high for the interval to be
+// represented are effectively unlimited.
+func (ks *KeyspaceScan) interval(batch int) time.Duration {
+	if d := time.Second * time.Duration(batch) / time.Duration(ks.Rate); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
+
+// PrefixUsage holds estimated memory usage of all keys sharing the same prefix
+type PrefixUsage struct {
+	Prefix string
+	Keys   uint64  // estimated number of keys
+	Bytes  uint64  // estimated memory usage
+	Share  float64 // percent of estimated memory usage of all keys
+}
+
+// GiB returns Bytes in GiB
+func (p PrefixUsage) GiB() float64 { return float64(p.Bytes>>20) / 1024 }
+
+// prefixes scans keyspace of Redis database 0 and returns top prefixes by
+// estimated memory usage.
+func (ks *KeyspaceScan) prefixes(ctx context.Context, ep Endpoint) ([]PrefixUsage, error) {
+	client := redis.NewClient(ep.options())
+	defer client.Close()
+	const batch = 100
+	ticker := time.NewTicker(ks.interval(batch))
+	defer ticker.Stop()
+
+	usage := make(map[string]*PrefixUsage)
+	var cursor uint64
+	var sample []string
+	for {
+		keys, next, err := client.Scan(ctx, cursor, "", batch).Result()
+		if err != nil {
+			return nil, err
+		}
+		sample = sample[:0]
+		for _, key := range keys {
+			if ks.Sample < 1 && rand.Float64() >= ks.Sample {
+				continue
+			}
+			sample = append(sample, key)
+		}
+		if len(sample) != 0 {
+			cmds := make([]*redis.IntCmd, len(sample))
+			_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i, key := range sample {
+					cmds[i] = pipe.MemoryUsage(ctx, key)
+				}
+				return nil
+			})
+			if err != nil && err != redis.Nil {
+				return nil, err
+			}
+			for i, cmd := range cmds {
+				n, err := cmd.Result()
+				if err == redis.Nil {
+					continue // key expired or was removed since scan
+				}
+				if err != nil {
+					return nil, err
+				}
+				prefix := sample[i]
+				if i := strings.Index(prefix, ks.Delimiter); i >= 0 {
+					prefix = prefix[:i]
+				}
+				u, ok := usage[prefix]
+				if !ok {
+					u = &PrefixUsage{Prefix: prefix}
+					usage[prefix] = u
+				}
+				u.Keys++
+				u.Bytes += uint64(n)
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	out := make([]PrefixUsage, 0, len(usage))
+	var total uint64
+	for _, u := range usage {
+		u.Keys = uint64(float64(u.Keys) / ks.Sample)
+		u.Bytes = uint64(float64(u.Bytes) / ks.Sample)
+		total += u.Bytes
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes == out[j].Bytes {
+			return out[i].Prefix < out[j].Prefix
+		}
+		return out[i].Bytes > out[j].Bytes
+	})
+	if len(out) > ks.Top {
+		out = out[:ks.Top]
+	}
+	for i := range out {
+		out[i].Share = float64(out[i].Bytes) / float64(total) * 100
+	}
+	return out, nil
+}
@@ -0,0 +1,25 @@
+package sizing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyspaceScanInterval(t *testing.T) {
+	for _, tc := range []struct {
+		rate, batch int
+		want        time.Duration
+	}{
+		{1, 100, 100 * time.Second},
+		{1000, 100, 100 * time.Millisecond},
+		{1000000000, 100, 100 * time.Nanosecond},
+		{1000000000, 1, time.Nanosecond},
+		{2000000000, 1, time.Nanosecond}, // would round down to zero
+		{1 << 30, 1, time.Nanosecond},    // would round down to zero
+	} {
+		ks := KeyspaceScan{Rate: tc.rate}
+		if got := ks.interval(tc.batch); got != tc.want {
+			t.Errorf("interval of rate %d and batch %d = %v, want %v", tc.rate, tc.batch, got, tc.want)
+		}
+	}
+}
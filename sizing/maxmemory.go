@@ -1,5 +1,5 @@
 // Code generated by parse-maxmemory; DO NOT EDIT.
 
-package main
+package sizing
 
 var maxmemoryValues = map[string]uint64{"cache.c1.xlarge": 0x183800000, "cache.m1.large": 0x1a2c00000, "cache.m1.medium": 0xb8600000, "cache.m1.small": 0x38400000, "cache.m1.xlarge": 0x377800000, "cache.m2.2xlarge": 0x827800000, "cache.m2.4xlarge": 0x1081000000, "cache.m2.xlarge": 0x3fac00000, "cache.m3.2xlarge": 0x6fb800000, "cache.m3.large": 0x183800000, "cache.m3.medium": 0xb2200000, "cache.m3.xlarge": 0x352000000, "cache.m4.10xlarge": 0x26a935851f, "cache.m4.2xlarge": 0x76cbd73d7, "cache.m4.4xlarge": 0xf31a33b85, "cache.m4.large": 0x19ad4a000, "cache.m4.xlarge": 0x391a66000, "cache.m5.12xlarge": 0x2748416d9a, "cache.m5.24xlarge": 0x4e9499e59a, "cache.m5.2xlarge": 0x682f1819a, "cache.m5.4xlarge": 0xd10c8eccd, "cache.m5.large": 0x19890059a, "cache.m5.xlarge": 0x33c05e733, "cache.r3.2xlarge": 0xe8d000000, "cache.r3.4xlarge": 0x1d71800000, "cache.r3.8xlarge": 0x3b3a800000, "cache.r3.large": 0x35e800000, "cache.r3.xlarge": 0x71ac00000, "cache.r4.16xlarge": 0x65c0840000, "cache.r4.2xlarge": 0xc9e6ccccd, "cache.r4.4xlarge": 0x195879999a, "cache.r4.8xlarge": 0x32d109999a, "cache.r4.large": 0x312e33334, "cache.r4.xlarge": 0x643426667, "cache.r5.12xlarge": 0x4f717bab33, "cache.r5.24xlarge": 0x9ee7558333, "cache.r5.2xlarge": 0xd343ffccd, "cache.r5.4xlarge": 0x1a73acf800, "cache.r5.large": 0x344ae6266, "cache.r5.xlarge": 0x694899a66, "cache.t1.micro": 0x8800000, "cache.t2.medium": 0xce500000, "cache.t2.micro": 0x22b00000, "cache.t2.small": 0x63400000, "cache.t3.medium": 0xc5c28f5c, "cache.t3.micro": 0x20000000, "cache.t3.small": 0x57ae147b}
@@ -0,0 +1,337 @@
+package sizing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/jmespath/go-jmespath"
+)
+
+// DefaultEngine is the engine offerings are fetched for if not set otherwise
+const DefaultEngine = "redis"
+
+// Engines maps supported engines to cacheEngine values of AWS price list
+var Engines = map[string]string{
+	"redis":  "Redis",
+	"valkey": "Valkey",
+}
+
+// OfferingsQuery selects offerings to fetch
+type OfferingsQuery struct {
+	Engine       string // one of Engines keys, DefaultEngine if empty
+	Location     string // AWS region description, i.e. "US East (N. Virginia)"
+	InstanceType string // only fetch offerings of this instance type, if set
+
+	AnyFamily     bool // include all instance families, not only memory-optimized
+	AnyGeneration bool // include previous generation instance types
+
+	// Value of reserved-memory-percent ElastiCache parameter offerings memory
+	// is corrected to
+	ReservedMemoryPercent int
+}
+
+func (q OfferingsQuery) engine() string {
+	if q.Engine == "" {
+		return DefaultEngine
+	}
+	return q.Engine
+}
+
+// Filters returns AWS Price List API filters matching query
+func (q OfferingsQuery) Filters() []*pricing.Filter {
+	filter := func(field, value string) *pricing.Filter {
+		return &pricing.Filter{
+			Field: aws.String(field),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(value),
+		}
+	}
+	filters := []*pricing.Filter{
+		filter("cacheEngine", Engines[q.engine()]),
+		filter("location", q.Location),
+	}
+	if q.InstanceType != "" {
+		filters = append(filters, filter("instanceType", q.InstanceType))
+	}
+	if !q.AnyFamily {
+		filters = append(filters, filter("instanceFamily", "Memory optimized"))
+	}
+	if !q.AnyGeneration {
+		filters = append(filters, filter("currentGeneration", "yes"))
+	}
+	return filters
+}
+
+// FetchOfferings returns offerings matching query from provider, with their
+// memory corrected to q.ReservedMemoryPercent, sorted by memory.
+func FetchOfferings(ctx context.Context, p Provider, q OfferingsQuery) (Offerings, error) {
+	details, err := FetchOfferingDetails(ctx, p, q)
+	if err != nil {
+		return nil, err
+	}
+	offerings := make(Offerings, len(details))
+	for i, d := range details {
+		offerings[i] = d.Offering
+	}
+	return offerings, nil
+}
+
+// PriceListOffering returns offering described by a single AWS price list
+// product, with its memory corrected to resMemPct reserved-memory-percent.
+// Memory is the maxmemory value of the node type if it's known, or the node
+// memory otherwise, in which case offering has MaxmemoryEstimated set.
+func PriceListOffering(priceList aws.JSONValue, resMemPct int) (Offering, error) {
+	memory, err := extractMemory(priceList["product"])
+	if err != nil {
+		return Offering{}, err
+	}
+	instanceType, err := extractInstanceType(priceList["product"])
+	if err != nil {
+		return Offering{}, err
+	}
+	price, err := extractPrice(priceList["terms"])
+	if err != nil {
+		return Offering{}, err
+	}
+	mem, ok := maxmemoryValues[instanceType]
+	if !ok {
+		mem = memory
+	}
+	return Offering{
+		Memory:             mem - (mem / 100 * uint64(resMemPct)),
+		PricePerHour:       price,
+		InstanceType:       instanceType,
+		MaxmemoryEstimated: !ok,
+	}, nil
+}
+
+// Offerings is a list of offerings, methods matching Redis memory to
+// offerings expect it to be sorted by memory.
+type Offerings []Offering
+
+// SortByMemory sorts offerings by memory, and by price for the same memory
+func (ofs Offerings) SortByMemory() {
+	sort.Slice(ofs, func(i, j int) bool {
+		if ofs[i].Memory == ofs[j].Memory {
+			return ofs[i].PricePerHour < ofs[j].PricePerHour
+		}
+		return ofs[i].Memory < ofs[j].Memory
+	})
+}
+
+// Match returns the cheapest offering allowed by policy that fits size at
+// maxLoadPct load, or the smallest one if policy.SmallestFit is set. If
+// policy has preferred families, the best fitting offering of the first
+// preferred family priced within policy tolerance of the best fit is
+// returned instead.
+func (ofs Offerings) Match(size uint64, maxLoadPct int, policy MatchPolicy) (Offering, error) {
+	fits := ofs.Fits(size, maxLoadPct, policy)
+	if len(fits) == 0 {
+		return Offering{}, errors.New("no matching offering found")
+	}
+	best := policy.best(fits)
+	maxPrice := best.PricePerHour * (1 + policy.Tolerance/100)
+	for _, family := range policy.Prefer {
+		var ofFamily Offerings
+		for _, o := range fits {
+			if o.Family() == family {
+				ofFamily = append(ofFamily, o)
+			}
+		}
+		if len(ofFamily) == 0 {
+			continue
+		}
+		if o := policy.best(ofFamily); o.PricePerHour <= maxPrice {
+			return o, nil
+		}
+	}
+	return best, nil
+}
+
+// Fits returns offerings allowed by policy that fit size at maxLoadPct load,
+// sorted by memory
+func (ofs Offerings) Fits(size uint64, maxLoadPct int, policy MatchPolicy) Offerings {
+	i := sort.Search(len(ofs), func(i int) bool { return ofs[i].Memory/100*uint64(maxLoadPct) >= size })
+	var out Offerings
+	for _, o := range ofs[i:] {
+		if policy.allowed(o) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// Candidates returns up to n cheapest offerings allowed by policy that fit
+// size at maxLoadPct load, with their load percent for size. Offerings of
+// the same price are ordered by memory.
+func (ofs Offerings) Candidates(size uint64, maxLoadPct int, policy MatchPolicy, n int) []Candidate {
+	fits := ofs.Fits(size, maxLoadPct, policy)
+	sort.SliceStable(fits, func(i, j int) bool { return fits[i].PricePerHour < fits[j].PricePerHour })
+	if len(fits) > n {
+		fits = fits[:n]
+	}
+	out := make([]Candidate, len(fits))
+	for i, o := range fits {
+		out[i] = Candidate{Offering: o, Load: float64(size) / float64(o.Memory) * 100}
+	}
+	return out
+}
+
+// Candidate is an offering fitting Redis memory
+type Candidate struct {
+	Offering
+	Load float64 // percent of offering memory used
+}
+
+// MatchPolicy limits offerings considered by Offerings.Match
+type MatchPolicy struct {
+	Include []string // instance type or family patterns, all allowed if empty
+	Exclude []string // instance type or family patterns
+
+	Prefer    []string // instance families in order of preference
+	Tolerance float64  // percent of price over the best fit a preferred family may cost
+
+	SmallestFit bool // match the smallest fitting offering instead of the cheapest one
+}
+
+// best returns the cheapest of offerings sorted by memory and price, preferring smaller
+// ones of the same price, or the smallest one if p.SmallestFit is set
+func (p MatchPolicy) best(fits Offerings) Offering {
+	out := fits[0]
+	if p.SmallestFit {
+		return out
+	}
+	for _, o := range fits[1:] {
+		if o.PricePerHour < out.PricePerHour {
+			out = o
+		}
+	}
+	return out
+}
+
+// Validate checks that policy patterns are valid
+func (p MatchPolicy) Validate() error {
+	for _, pat := range append(p.Include, p.Exclude...) {
+		if _, err := path.Match(pat, ""); err != nil {
+			return fmt.Errorf("invalid instance type pattern %q: %w", pat, err)
+		}
+	}
+	if p.Tolerance < 0 {
+		return errors.New("preferred family price tolerance cannot be negative")
+	}
+	return nil
+}
+
+// allowed reports whether offering is allowed by include and exclude
+// patterns, which are matched against both instance type and family
+func (p MatchPolicy) allowed(o Offering) bool {
+	matches := func(patterns []string) bool {
+		for _, pat := range patterns {
+			if ok, _ := path.Match(pat, o.InstanceType); ok {
+				return true
+			}
+			if ok, _ := path.Match(pat, o.Family()); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(p.Include) != 0 && !matches(p.Include) {
+		return false
+	}
+	return !matches(p.Exclude)
+}
+
+// Offering is an ElastiCache node type with its price
+type Offering struct {
+	Memory       uint64 // maxmemory of the node type corrected to reserved-memory-percent
+	PricePerHour float64
+	InstanceType string
+
+	// Exact maxmemory of the node type is unknown, Memory is based on node
+	// memory instead
+	MaxmemoryEstimated bool `json:",omitempty"`
+}
+
+// Family returns instance family, i.e. "r6g" for "cache.r6g.large"
+func (o Offering) Family() string {
+	family := strings.TrimPrefix(o.InstanceType, "cache.")
+	if i := strings.IndexByte(family, '.'); i != -1 {
+		family = family[:i]
+	}
+	return family
+}
+
+// HoursPerMonth is the number of hours of a 31 days month monthly prices are
+// calculated for
+const HoursPerMonth = 24 * 31
+
+// PricePerMonth returns on-demand price of a 31 days month
+func (o Offering) PricePerMonth() float64 {
+	return o.PricePerHour * HoursPerMonth
+}
+
+// MemoryGiB returns Memory in GiB
+func (o Offering) MemoryGiB() float64 {
+	return float64(o.Memory>>20) / 1024
+}
+
+var queryPrice = jmespath.MustCompile("OnDemand.*[].priceDimensions.*[].pricePerUnit.USD | [0]")
+var queryIstanceType = jmespath.MustCompile("attributes.instanceType")
+var queryMemory = jmespath.MustCompile("attributes.memory")
+
+func extractInstanceType(data interface{}) (string, error) {
+	raw, err := queryIstanceType.Search(data)
+	if err != nil {
+		return "", err
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+	}
+	return s, nil
+}
+
+func extractMemory(data interface{}) (uint64, error) {
+	raw, err := queryMemory.Search(data)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+	}
+	const suffix = " GiB"
+	if !strings.HasSuffix(s, suffix) {
+		return 0, fmt.Errorf("unsupported memory spec format, want \"XXX GiB\", got %q", s)
+	}
+	gibs, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 32)
+	if err != nil {
+		return 0, err
+	}
+	if gibs <= 0 {
+		return 0, fmt.Errorf("unexpected memory value %v (%q)", gibs, s)
+	}
+	return uint64(gibs * 1024 * 1024 * 1024), nil
+}
+
+func extractPrice(data interface{}) (float64, error) {
+	raw, err := queryPrice.Search(data)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("cannot convert %T / %+v to string", raw, raw)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+//go:generate go run ../parse-maxmemory maxmemory.go
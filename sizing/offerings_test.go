@@ -0,0 +1,155 @@
+package sizing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const gib = 1 << 30
+
+// testOfferings are sorted by memory, the newer generation cache.r6g.large
+// is both larger and cheaper than cache.r4.large
+var testOfferings = Offerings{
+	{Memory: 6 * gib, PricePerHour: 0.156, InstanceType: "cache.m5.large"},
+	{Memory: 12 * gib, PricePerHour: 0.228, InstanceType: "cache.r4.large"},
+	{Memory: 13 * gib, PricePerHour: 0.206, InstanceType: "cache.r6g.large"},
+	{Memory: 13 * gib, PricePerHour: 0.216, InstanceType: "cache.r5.large"},
+	{Memory: 26 * gib, PricePerHour: 0.411, InstanceType: "cache.r6g.xlarge"},
+	{Memory: 26 * gib, PricePerHour: 0.431, InstanceType: "cache.r5.xlarge"},
+}
+
+func TestOfferingsMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		size    uint64
+		maxLoad int
+		policy  MatchPolicy
+		want    string // instance type, empty if no match expected
+	}{
+		{name: "cheapest fit", size: 10 * gib, maxLoad: 100, want: "cache.r6g.large"},
+		{name: "smallest fit", size: 10 * gib, maxLoad: 100, policy: MatchPolicy{SmallestFit: true}, want: "cache.r4.large"},
+		{name: "smallest fit above old", size: 25 * gib / 2, maxLoad: 100, policy: MatchPolicy{SmallestFit: true}, want: "cache.r6g.large"},
+		{name: "max load", size: 10 * gib, maxLoad: 50, want: "cache.r6g.xlarge"},
+		{name: "fits smallest", size: gib, maxLoad: 80, want: "cache.m5.large"},
+		{
+			name: "preferred within tolerance", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Prefer: []string{"r5"}, Tolerance: 10},
+			want:   "cache.r5.large",
+		},
+		{
+			name: "preferred outside tolerance", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Prefer: []string{"r5"}, Tolerance: 2},
+			want:   "cache.r6g.large",
+		},
+		{
+			name: "first preferred not fitting", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Prefer: []string{"m5", "r5"}, Tolerance: 10},
+			want:   "cache.r5.large",
+		},
+		{
+			name: "preferred with smallest fit", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Prefer: []string{"r5"}, Tolerance: 10, SmallestFit: true},
+			want:   "cache.r5.large",
+		},
+		{
+			name: "include family", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Include: []string{"r5"}},
+			want:   "cache.r5.large",
+		},
+		{
+			name: "include type pattern", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Include: []string{"cache.r4.*"}},
+			want:   "cache.r4.large",
+		},
+		{
+			name: "exclude family", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Exclude: []string{"r6g"}},
+			want:   "cache.r5.large",
+		},
+		{
+			name: "include and exclude", size: 10 * gib, maxLoad: 100,
+			policy: MatchPolicy{Include: []string{"r*"}, Exclude: []string{"cache.r6g.*", "r5"}},
+			want:   "cache.r4.large",
+		},
+		{name: "too large", size: 30 * gib, maxLoad: 100},
+		{name: "excluded all fitting", size: 10 * gib, maxLoad: 100, policy: MatchPolicy{Include: []string{"m5"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := testOfferings.Match(tc.size, tc.maxLoad, tc.policy)
+			if tc.want == "" {
+				if err == nil {
+					t.Errorf("got %s, want no match", got.InstanceType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.InstanceType != tc.want {
+				t.Errorf("got %s, want %s", got.InstanceType, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchPolicyBest(t *testing.T) {
+	// the same price, the smaller one is preferred
+	fits := Offerings{
+		{Memory: 12 * gib, PricePerHour: 0.3, InstanceType: "cache.r4.large"},
+		{Memory: 13 * gib, PricePerHour: 0.2, InstanceType: "cache.r6g.large"},
+		{Memory: 26 * gib, PricePerHour: 0.2, InstanceType: "cache.m6g.xlarge"},
+	}
+	if got := (MatchPolicy{}).best(fits); got.InstanceType != "cache.r6g.large" {
+		t.Errorf("got %s, want cache.r6g.large", got.InstanceType)
+	}
+	if got := (MatchPolicy{SmallestFit: true}).best(fits); got.InstanceType != "cache.r4.large" {
+		t.Errorf("got %s with smallest fit, want cache.r4.large", got.InstanceType)
+	}
+}
+
+func TestOfferingsCandidates(t *testing.T) {
+	got := testOfferings.Candidates(10*gib, 100, MatchPolicy{Exclude: []string{"r5"}}, 3)
+	var types []string
+	for _, c := range got {
+		types = append(types, c.InstanceType)
+	}
+	if want := []string{"cache.r6g.large", "cache.r4.large", "cache.r6g.xlarge"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("got %v, want %v", types, want)
+	}
+	if want := 10.0 / 13 * 100; got[0].Load < want-1e-9 || got[0].Load > want+1e-9 {
+		t.Errorf("got load %v, want %v", got[0].Load, want)
+	}
+}
+
+func TestPriceListOffering(t *testing.T) {
+	product := func(instanceType, memory string) aws.JSONValue {
+		return aws.JSONValue{
+			"product": map[string]interface{}{"attributes": map[string]interface{}{
+				"instanceType": instanceType,
+				"memory":       memory,
+			}},
+			"terms": map[string]interface{}{"OnDemand": map[string]interface{}{"term": map[string]interface{}{
+				"priceDimensions": map[string]interface{}{"dim": map[string]interface{}{
+					"pricePerUnit": map[string]interface{}{"USD": "0.5"},
+				}},
+			}}},
+		}
+	}
+	for _, tc := range []struct {
+		instanceType string
+		want         Offering
+	}{
+		{"cache.r5.large", Offering{Memory: 0x344ae6266 - 0x344ae6266/100*25, PricePerHour: 0.5, InstanceType: "cache.r5.large"}},
+		{"cache.x9.large", Offering{Memory: 12*gib - 12*gib/100*25, PricePerHour: 0.5, InstanceType: "cache.x9.large", MaxmemoryEstimated: true}},
+	} {
+		got, err := PriceListOffering(product(tc.instanceType, "12 GiB"), 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("got %+v, want %+v", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sizing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pricing"
+)
+
+// Provider provides AWS price list products of ElastiCache, in the format
+// returned by AWS Price List API GetProducts call
+type Provider interface {
+	// Products returns products matching query filters, see
+	// OfferingsQuery.Filters
+	Products(ctx context.Context, q OfferingsQuery) ([]aws.JSONValue, error)
+}
+
+// NewAPIProvider returns Provider fetching products from AWS Price List API.
+// The API is only available in some regions, i.e. us-east-1, regardless of
+// query location.
+func NewAPIProvider(svc *pricing.Pricing) Provider { return apiProvider{svc: svc} }
+
+type apiProvider struct {
+	svc *pricing.Pricing
+}
+
+func (p apiProvider) Products(ctx context.Context, q OfferingsQuery) ([]aws.JSONValue, error) {
+	var out []aws.JSONValue
+	fn := func(res *pricing.GetProductsOutput, _ bool) bool {
+		out = append(out, res.PriceList...)
+		return true
+	}
+	if err := p.svc.GetProductsPagesWithContext(ctx, &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonElastiCache"),
+		Filters:     q.Filters(),
+	}, fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Matches reports whether price list product matches query filters, the way
+// AWS Price List API matches them
+func (q OfferingsQuery) Matches(priceList aws.JSONValue) bool {
+	product, _ := priceList["product"].(map[string]interface{})
+	attrs, _ := product["attributes"].(map[string]interface{})
+	for _, f := range q.Filters() {
+		if v, _ := attrs[aws.StringValue(f.Field)].(string); !strings.EqualFold(v, aws.StringValue(f.Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot is a Provider of price list products saved at some point in time,
+// it allows to size Redis without access to AWS Price List API, and to
+// compare prices over time
+type Snapshot struct {
+	Time      time.Time
+	PriceList []aws.JSONValue // products in AWS Price List API format
+}
+
+// Products returns snapshot products matching q. It fails if snapshot has no
+// products in q.Location at all.
+func (s *Snapshot) Products(_ context.Context, q OfferingsQuery) ([]aws.JSONValue, error) {
+	var out []aws.JSONValue
+	var inLocation bool
+	for _, pl := range s.PriceList {
+		if q.Matches(pl) {
+			out = append(out, pl)
+		}
+		if !inLocation {
+			product, _ := pl["product"].(map[string]interface{})
+			attrs, _ := product["attributes"].(map[string]interface{})
+			location, _ := attrs["location"].(string)
+			inLocation = strings.EqualFold(location, q.Location)
+		}
+	}
+	if !inLocation {
+		return nil, fmt.Errorf("no products in %s among prices as of %s", q.Location, s.Time.Format(time.RFC3339))
+	}
+	return out, nil
+}
+
+// TakeSnapshot returns snapshot of products p provides for queries. Products
+// matching several queries are included once.
+func TakeSnapshot(ctx context.Context, p Provider, queries ...OfferingsQuery) (*Snapshot, error) {
+	s := &Snapshot{Time: time.Now().UTC()}
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		products, err := p.Products(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, pl := range products {
+			product, _ := pl["product"].(map[string]interface{})
+			if sku, _ := product["sku"].(string); sku != "" {
+				if seen[sku] {
+					continue
+				}
+				seen[sku] = true
+			}
+			s.PriceList = append(s.PriceList, pl)
+		}
+	}
+	return s, nil
+}
+
+// ReadSnapshot reads snapshot written by Snapshot.Write
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := new(Snapshot)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("reading pricing snapshot: %w", err)
+	}
+	return s, nil
+}
+
+// Write writes snapshot as JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,130 @@
+package sizing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// priceListProduct returns AWS price list product with sku and attributes
+func priceListProduct(sku string, attrs map[string]interface{}) aws.JSONValue {
+	return aws.JSONValue{"product": map[string]interface{}{"sku": sku, "attributes": attrs}}
+}
+
+func r5Large(engine string) map[string]interface{} {
+	return map[string]interface{}{
+		"cacheEngine":       engine,
+		"location":          "US East (N. Virginia)",
+		"instanceType":      "cache.r5.large",
+		"instanceFamily":    "Memory optimized",
+		"currentGeneration": "Yes",
+	}
+}
+
+func TestOfferingsQueryMatches(t *testing.T) {
+	q := OfferingsQuery{Location: "US East (N. Virginia)"}
+	with := func(key string, value interface{}) map[string]interface{} {
+		attrs := r5Large("Redis")
+		if value == nil {
+			delete(attrs, key)
+		} else {
+			attrs[key] = value
+		}
+		return attrs
+	}
+	for _, tc := range []struct {
+		name  string
+		q     OfferingsQuery
+		attrs map[string]interface{}
+		want  bool
+	}{
+		{name: "default engine", q: q, attrs: r5Large("Redis"), want: true},
+		{name: "case insensitive", q: q, attrs: with("location", "us east (n. virginia)"), want: true},
+		{name: "other engine", q: q, attrs: r5Large("Valkey")},
+		{name: "engine", q: OfferingsQuery{Engine: "valkey", Location: q.Location}, attrs: r5Large("Valkey"), want: true},
+		{name: "other location", q: q, attrs: with("location", "EU (Ireland)")},
+		{name: "instance type", q: OfferingsQuery{Location: q.Location, InstanceType: "cache.r5.large"}, attrs: r5Large("Redis"), want: true},
+		{name: "other instance type", q: OfferingsQuery{Location: q.Location, InstanceType: "cache.r5.xlarge"}, attrs: r5Large("Redis")},
+		{name: "other family", q: q, attrs: with("instanceFamily", "Standard")},
+		{name: "any family", q: OfferingsQuery{Location: q.Location, AnyFamily: true}, attrs: with("instanceFamily", "Standard"), want: true},
+		{name: "previous generation", q: q, attrs: with("currentGeneration", "No")},
+		{name: "any generation", q: OfferingsQuery{Location: q.Location, AnyGeneration: true}, attrs: with("currentGeneration", "No"), want: true},
+		{name: "missing attribute", q: q, attrs: with("instanceFamily", nil)},
+		{name: "non-string attribute", q: q, attrs: with("location", 1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.q.Matches(priceListProduct("sku", tc.attrs)); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotProducts(t *testing.T) {
+	s := &Snapshot{
+		Time: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		PriceList: []aws.JSONValue{
+			priceListProduct("redis", r5Large("Redis")),
+			priceListProduct("valkey", r5Large("Valkey")),
+		},
+	}
+	got, err := s.Products(context.Background(), OfferingsQuery{Engine: "valkey", Location: "US East (N. Virginia)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := s.PriceList[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// no products of a query in a known location is not an error
+	got, err = s.Products(context.Background(), OfferingsQuery{Location: "US East (N. Virginia)", InstanceType: "cache.r5.xlarge"})
+	if err != nil || len(got) != 0 {
+		t.Errorf("got %v, %v, want no products and no error", got, err)
+	}
+
+	_, err = s.Products(context.Background(), OfferingsQuery{Location: "EU (Ireland)"})
+	if want := "no products in EU (Ireland) among prices as of 2020-06-01T00:00:00Z"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// fakeProvider returns products by query location
+type fakeProvider map[string][]aws.JSONValue
+
+func (p fakeProvider) Products(_ context.Context, q OfferingsQuery) ([]aws.JSONValue, error) {
+	products, ok := p[q.Location]
+	if !ok {
+		return nil, errors.New("unknown location")
+	}
+	return products, nil
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	redis := priceListProduct("redis", r5Large("Redis"))
+	valkey := priceListProduct("valkey", r5Large("Valkey"))
+	noSKU := priceListProduct("", r5Large("Redis"))
+	p := fakeProvider{
+		"a": {redis, noSKU},
+		"b": {valkey, redis, noSKU},
+	}
+	ctx := context.Background()
+	s, err := TakeSnapshot(ctx, p, OfferingsQuery{Location: "a"}, OfferingsQuery{Location: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// products without SKU can't be told apart and are all kept
+	if want := []aws.JSONValue{redis, noSKU, valkey, noSKU}; !reflect.DeepEqual(s.PriceList, want) {
+		t.Errorf("got %v, want %v", s.PriceList, want)
+	}
+	if s.Time.IsZero() || s.Time.Location() != time.UTC {
+		t.Errorf("got snapshot time %v, want current UTC time", s.Time)
+	}
+
+	if _, err := TakeSnapshot(ctx, p, OfferingsQuery{Location: "a"}, OfferingsQuery{Location: "c"}); err == nil {
+		t.Error("got no error of failing provider")
+	}
+}
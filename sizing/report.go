@@ -0,0 +1,366 @@
+package sizing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RowOptions configure how a single Redis is matched to offerings
+type RowOptions struct {
+	MaxLoad int // percent of offering memory Redis may use, [1,100] range
+
+	// Reserved memory percent and engine offerings were fetched for, only
+	// used for reporting
+	ReservedMemoryPercent int
+	Engine                string
+
+	// If not 0, evicting caches are matched for memory estimated to reach
+	// this percent hit ratio, see RedisStats.HitRatioSize
+	TargetHitRatio float64
+
+	Policy     MatchPolicy
+	Candidates int // number of cheapest candidates to report, 0 disables
+
+	// Number of identical nodes Redis runs on, i.e. primary and replicas,
+	// monthly costs are multiplied by; 0 means a single node
+	Nodes int
+}
+
+// NewReportRow matches Redis to offerings based on its used and peak memory.
+// Offerings must be sorted by memory.
+func NewReportRow(st RedisStats, ofs Offerings, opts RowOptions) (ReportRow, error) {
+	row := ReportRow{
+		Redis:                 st,
+		MaxLoad:               opts.MaxLoad,
+		ReservedMemoryPercent: opts.ReservedMemoryPercent,
+		Engine:                opts.Engine,
+	}
+	if opts.Nodes > 1 {
+		row.Nodes = opts.Nodes
+	}
+	used, peak := st.UsedBytes, st.PeakBytes
+	// hit ratio estimate only ever grows the cache: target below its current
+	// hit ratio gives size smaller than used memory, which is then kept
+	if st.Evicting() && opts.TargetHitRatio != 0 {
+		if size, ok := st.HitRatioSize(opts.TargetHitRatio); ok && size > used {
+			used = size
+			row.HitRatioBytes = size
+		}
+	}
+	if peak < used {
+		peak = used
+	}
+	plan1, err := ofs.Match(used, opts.MaxLoad, opts.Policy)
+	if err != nil {
+		return ReportRow{}, fmt.Errorf("no matching plan for %q with %.1f GiB of used memory: %w", st.Addr, float64(used)/(1<<30), err)
+	}
+	plan2, err := ofs.Match(peak, opts.MaxLoad, opts.Policy)
+	if err != nil {
+		return ReportRow{}, fmt.Errorf("no matching plan for %q with %.1f GiB of peak memory: %w", st.Addr, float64(peak)/(1<<30), err)
+	}
+	row.UsedRatio = float64(used) / float64(plan1.Memory) * 100
+	row.PeakRatio = float64(peak) / float64(plan2.Memory) * 100
+	row.UsedBased = plan1
+	row.PeakBased = plan2
+	if opts.Candidates != 0 {
+		row.UsedCandidates = ofs.Candidates(used, opts.MaxLoad, opts.Policy, opts.Candidates)
+		row.PeakCandidates = ofs.Candidates(peak, opts.MaxLoad, opts.Policy, opts.Candidates)
+	}
+	return row, nil
+}
+
+// NewReport returns report of rows with totals computed. If groupBy is not
+// empty, rows are grouped by this label and ordered by group. Time is set to
+// the current time, other report fields are expected to be set by caller.
+func NewReport(rows []ReportRow, groupBy string) Report {
+	rep := Report{
+		Rows:    rows,
+		Time:    time.Now().UTC(),
+		GroupBy: groupBy,
+	}
+	for _, row := range rows {
+		rep.UsedBasedTotal += row.UsedPricePerMonth()
+		rep.PeakBasedTotal += row.PeakPricePerMonth()
+		if row.Current != nil {
+			rep.CurrentTotal += row.CurrentPricePerMonth()
+			rep.UsedSavingsTotal += row.UsedSavings()
+			rep.PeakSavingsTotal += row.PeakSavings()
+		}
+	}
+	if groupBy != "" {
+		rep.Groups = GroupRows(rows, groupBy)
+		rep.Rows = make([]ReportRow, 0, len(rows))
+		for _, g := range rep.Groups {
+			rep.Rows = append(rep.Rows, g.Rows...)
+		}
+	}
+	return rep
+}
+
+// Report is the result of matching Redis instances to offerings
+type Report struct {
+	Rows                  []ReportRow
+	UsedBasedTotal        float64
+	PeakBasedTotal        float64
+	Time                  time.Time
+	Region                string
+	MaxLoad               int
+	ReservedMemoryPercent int
+	Engine                string  `json:",omitempty"` // DefaultEngine if empty
+	TargetHitRatio        float64 `json:",omitempty"`
+	CurrentTotal          float64 `json:",omitempty"`
+	UsedSavingsTotal      float64 `json:",omitempty"`
+	PeakSavingsTotal      float64 `json:",omitempty"`
+
+	GroupBy string        `json:",omitempty"` // label rows are grouped by
+	Groups  []ReportGroup `json:",omitempty"`
+}
+
+// RowGroups returns Report groups, or a single group of all rows if report
+// is not grouped
+func (r Report) RowGroups() []ReportGroup {
+	if len(r.Groups) == 0 {
+		return []ReportGroup{{Rows: r.Rows}}
+	}
+	return r.Groups
+}
+
+// ReportGroup is a set of Report rows sharing the same value of the label
+// Report is grouped by
+type ReportGroup struct {
+	Name             string      // label value, empty for rows without the label
+	Rows             []ReportRow `json:"-"`
+	Redises          int
+	UsedBasedTotal   float64
+	PeakBasedTotal   float64
+	CurrentTotal     float64 `json:",omitempty"`
+	UsedSavingsTotal float64 `json:",omitempty"`
+	PeakSavingsTotal float64 `json:",omitempty"`
+}
+
+// Title returns group name for display
+func (g ReportGroup) Title() string {
+	if g.Name == "" {
+		return "(none)"
+	}
+	return g.Name
+}
+
+// GroupRows groups rows by value of the label, keeping rows order within
+// groups. Groups are sorted by name, with the group of rows without the
+// label last.
+func GroupRows(rows []ReportRow, label string) []ReportGroup {
+	idx := make(map[string]int)
+	var groups []ReportGroup
+	for _, row := range rows {
+		name := row.Redis.Labels[label]
+		i, ok := idx[name]
+		if !ok {
+			i = len(groups)
+			idx[name] = i
+			groups = append(groups, ReportGroup{Name: name})
+		}
+		g := &groups[i]
+		g.Rows = append(g.Rows, row)
+		g.Redises++
+		g.UsedBasedTotal += row.UsedPricePerMonth()
+		g.PeakBasedTotal += row.PeakPricePerMonth()
+		if row.Current != nil {
+			g.CurrentTotal += row.CurrentPricePerMonth()
+			g.UsedSavingsTotal += row.UsedSavings()
+			g.PeakSavingsTotal += row.PeakSavings()
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Name == "" || groups[j].Name == "" {
+			return groups[j].Name == ""
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// HasOverrides reports whether any of the Report rows was matched with
+// overridden max-load, reserved-memory-percent or engine
+func (r Report) HasOverrides() bool {
+	for _, row := range r.Rows {
+		if row.overridden(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCurrent reports whether any of the Report rows has current node
+func (r Report) HasCurrent() bool { return hasCurrent(r.Rows) }
+
+// HasLabels reports whether any of the Report rows has labels
+func (r Report) HasLabels() bool { return hasLabels(r.Rows) }
+
+func hasCurrent(rows []ReportRow) bool {
+	for _, row := range rows {
+		if row.Current != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLabels(rows []ReportRow) bool {
+	for _, row := range rows {
+		if len(row.Redis.Labels) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEvicting reports whether any of the Report rows is an evicting cache
+func (r Report) HasEvicting() bool {
+	for _, row := range r.Rows {
+		if row.Redis.Evicting() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCandidates reports whether any of the Report rows has candidates
+func (r Report) HasCandidates() bool {
+	for _, row := range r.Rows {
+		if len(row.UsedCandidates) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPrefixes reports whether any of the Report rows has keyspace breakdown
+func (r Report) HasPrefixes() bool {
+	for _, row := range r.Rows {
+		if len(row.Redis.Prefixes) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ReportRow is a single Redis matched to offerings
+type ReportRow struct {
+	Redis     RedisStats
+	UsedRatio float64
+	PeakRatio float64
+	UsedBased Offering
+	PeakBased Offering
+
+	// Estimated memory evicting cache needs to reach target hit ratio, only
+	// set if it is above used memory. Used based offering is then matched for
+	// it instead of used memory, and peak based one for the larger of it and
+	// peak memory.
+	HitRatioBytes uint64 `json:",omitempty"`
+
+	Current *Offering `json:",omitempty"` // current node, only for ElastiCache nodes
+	Nodes   int       `json:",omitempty"` // number of nodes if more than one, see RowOptions.Nodes
+
+	// Cheapest offerings fitting used and peak memory, only if requested
+	UsedCandidates []Candidate `json:",omitempty"`
+	PeakCandidates []Candidate `json:",omitempty"`
+
+	// Effective values offerings were matched with, may be overridden per
+	// Redis in inventory or address file
+	MaxLoad               int
+	ReservedMemoryPercent int
+	Engine                string
+}
+
+// overridden reports whether any of row effective values differ from report
+// defaults
+func (r ReportRow) overridden(rep Report) bool {
+	return r.MaxLoad != rep.MaxLoad || r.ReservedMemoryPercent != rep.ReservedMemoryPercent || r.Engine != rep.engine()
+}
+
+func (r Report) engine() string {
+	if r.Engine == "" {
+		return DefaultEngine
+	}
+	return r.Engine
+}
+
+// NodeCount returns number of nodes Redis runs on, at least one
+func (r ReportRow) NodeCount() int {
+	if r.Nodes < 1 {
+		return 1
+	}
+	return r.Nodes
+}
+
+// UsedPricePerMonth returns monthly price of used-based offering for all
+// nodes
+func (r ReportRow) UsedPricePerMonth() float64 {
+	return r.UsedBased.PricePerMonth() * float64(r.NodeCount())
+}
+
+// PeakPricePerMonth returns monthly price of peak-based offering for all
+// nodes
+func (r ReportRow) PeakPricePerMonth() float64 {
+	return r.PeakBased.PricePerMonth() * float64(r.NodeCount())
+}
+
+// CurrentPricePerMonth returns monthly price of current node type for all
+// nodes, 0 if current node is unknown
+func (r ReportRow) CurrentPricePerMonth() float64 {
+	if r.Current == nil {
+		return 0
+	}
+	return r.Current.PricePerMonth() * float64(r.NodeCount())
+}
+
+// UsedSavings returns monthly savings of used-based offering compared to the
+// current node
+func (r ReportRow) UsedSavings() float64 {
+	if r.Current == nil {
+		return 0
+	}
+	return r.CurrentPricePerMonth() - r.UsedPricePerMonth()
+}
+
+// PeakSavings returns monthly savings of peak-based offering compared to the
+// current node
+func (r ReportRow) PeakSavings() float64 {
+	if r.Current == nil {
+		return 0
+	}
+	return r.CurrentPricePerMonth() - r.PeakPricePerMonth()
+}
+
+// UsedGiB returns memory size used-based offering was matched for
+func (r ReportRow) UsedGiB() float64 {
+	if r.HitRatioBytes != 0 {
+		return float64(r.HitRatioBytes>>20) / 1024
+	}
+	return r.Redis.UsedGiB()
+}
+
+// PeakGiB returns memory size peak-based offering was matched for
+func (r ReportRow) PeakGiB() float64 {
+	if r.HitRatioBytes > r.Redis.PeakBytes {
+		return float64(r.HitRatioBytes>>20) / 1024
+	}
+	return r.Redis.PeakGiB()
+}
+
+// host returns Redis address annotated for the text report
+func (r ReportRow) host() string {
+	host := r.Redis.Addr
+	if r.Nodes > 1 {
+		host += fmt.Sprintf(" (%d nodes)", r.Nodes)
+	}
+	switch {
+	case r.HitRatioBytes != 0:
+		return host + " (sized for hit ratio)"
+	case r.Redis.Evicting():
+		return host + " (evicting)"
+	}
+	return host
+}
@@ -0,0 +1,153 @@
+package sizing
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestReportRowNodes(t *testing.T) {
+	current := Offering{InstanceType: "cache.r5.xlarge", PricePerHour: 0.431}
+	row := ReportRow{
+		Redis:     RedisStats{Addr: "replicated:6379"},
+		UsedBased: Offering{InstanceType: "cache.r5.large", PricePerHour: 0.216},
+		PeakBased: Offering{InstanceType: "cache.r5.xlarge", PricePerHour: 0.431},
+		Current:   &current,
+		Nodes:     3,
+	}
+	for _, tc := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"used", row.UsedPricePerMonth(), 3 * row.UsedBased.PricePerMonth()},
+		{"peak", row.PeakPricePerMonth(), 3 * row.PeakBased.PricePerMonth()},
+		{"current", row.CurrentPricePerMonth(), 3 * current.PricePerMonth()},
+		{"used savings", row.UsedSavings(), 3 * (current.PricePerMonth() - row.UsedBased.PricePerMonth())},
+		{"peak savings", row.PeakSavings(), 0},
+	} {
+		if d := tc.got - tc.want; d > 1e-6 || d < -1e-6 {
+			t.Errorf("%s: got %.3f, want %.3f", tc.name, tc.got, tc.want)
+		}
+	}
+	if got, want := row.host(), "replicated:6379 (3 nodes)"; got != want {
+		t.Errorf("got host %q, want %q", got, want)
+	}
+
+	row.Nodes = 0
+	if got := row.NodeCount(); got != 1 {
+		t.Errorf("got %d nodes of single node Redis, want 1", got)
+	}
+	if got, want := row.UsedPricePerMonth(), row.UsedBased.PricePerMonth(); got != want {
+		t.Errorf("got used price %.3f of single node Redis, want %.3f", got, want)
+	}
+}
+
+func TestNewReportRowHitRatio(t *testing.T) {
+	evicting := RedisStats{Addr: "cache:6379", UsedBytes: 4 * gib, PeakBytes: 7 * gib,
+		EvictedKeys: 5000, KeyspaceHits: 900, KeyspaceMisses: 100}
+	for _, tc := range []struct {
+		name      string
+		st        RedisStats
+		target    float64
+		hitRatio  bool // whether row is sized for hit ratio
+		used      string
+		peak      string
+		usedRatio float64 // percent, rounded
+	}{
+		{"hit ratio above used and peak", evicting, 95, true, "cache.r6g.large", "cache.r6g.large", 62},
+		{"hit ratio between used and peak", evicting, 91, true, "cache.m5.large", "cache.r6g.large", 74},
+		{"target below current hit ratio", evicting, 80, false, "cache.m5.large", "cache.r6g.large", 67},
+		{"no target", evicting, 0, false, "cache.m5.large", "cache.r6g.large", 67},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			row, err := NewReportRow(tc.st, testOfferings, RowOptions{MaxLoad: 100, TargetHitRatio: tc.target})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (row.HitRatioBytes != 0) != tc.hitRatio {
+				t.Errorf("got hit ratio size %d, want it set: %v", row.HitRatioBytes, tc.hitRatio)
+			}
+			if row.UsedBased.InstanceType != tc.used || row.PeakBased.InstanceType != tc.peak {
+				t.Errorf("got %s and %s, want %s and %s", row.UsedBased.InstanceType, row.PeakBased.InstanceType, tc.used, tc.peak)
+			}
+			if got := math.Round(row.UsedRatio); got != tc.usedRatio {
+				t.Errorf("got used ratio %.0f%%, want %.0f%%", got, tc.usedRatio)
+			}
+		})
+	}
+}
+
+// testGroupRows are rows of three teams, one of them without team label, and
+// one of them with current node
+func testGroupRows() []ReportRow {
+	r5Large := Offering{InstanceType: "cache.r5.large", PricePerHour: 0.216}
+	r5XLarge := Offering{InstanceType: "cache.r5.xlarge", PricePerHour: 0.431}
+	return []ReportRow{
+		{Redis: RedisStats{Addr: "b-1:6379", Labels: map[string]string{"team": "b"}}, UsedBased: r5Large, PeakBased: r5Large},
+		{Redis: RedisStats{Addr: "none:6379"}, UsedBased: r5Large, PeakBased: r5XLarge},
+		{Redis: RedisStats{Addr: "a-1:6379", Labels: map[string]string{"team": "a"}}, UsedBased: r5Large, PeakBased: r5Large,
+			Current: &r5XLarge, Nodes: 2},
+		{Redis: RedisStats{Addr: "b-2:6379", Labels: map[string]string{"team": "b", "env": "prod"}}, UsedBased: r5XLarge, PeakBased: r5XLarge},
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	groups := GroupRows(testGroupRows(), "team")
+	type group struct {
+		name  string
+		addrs []string
+		// hourly prices
+		used, peak, current, usedSaved float64
+	}
+	want := []group{
+		{"a", []string{"a-1:6379"}, 2 * 0.216, 2 * 0.216, 2 * 0.431, 2 * (0.431 - 0.216)},
+		{"b", []string{"b-1:6379", "b-2:6379"}, 0.216 + 0.431, 0.216 + 0.431, 0, 0},
+		{"", []string{"none:6379"}, 0.216, 0.431, 0, 0}, // rows without the label go last
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	hours := Offering{PricePerHour: 1}.PricePerMonth()
+	for i, g := range groups {
+		w := want[i]
+		var addrs []string
+		for _, row := range g.Rows {
+			addrs = append(addrs, row.Redis.Addr)
+		}
+		if g.Name != w.name || g.Redises != len(w.addrs) || !reflect.DeepEqual(addrs, w.addrs) {
+			t.Errorf("group %d: got %q of %d rows %v, want %q of %v", i, g.Name, g.Redises, addrs, w.name, w.addrs)
+		}
+		for _, tc := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"used", g.UsedBasedTotal, w.used * hours},
+			{"peak", g.PeakBasedTotal, w.peak * hours},
+			{"current", g.CurrentTotal, w.current * hours},
+			{"used savings", g.UsedSavingsTotal, w.usedSaved * hours},
+		} {
+			if d := tc.got - tc.want; d > 1e-6 || d < -1e-6 {
+				t.Errorf("group %q: got %s subtotal %.3f, want %.3f", g.Name, tc.name, tc.got, tc.want)
+			}
+		}
+	}
+	if got := groups[2].Title(); got != "(none)" {
+		t.Errorf("got title %q of rows without the label, want (none)", got)
+	}
+
+	rep := NewReport(testGroupRows(), "team")
+	var addrs []string
+	for _, row := range rep.Rows {
+		addrs = append(addrs, row.Redis.Addr)
+	}
+	if want := []string{"a-1:6379", "b-1:6379", "b-2:6379", "none:6379"}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("got report rows %v, want them ordered by group %v", addrs, want)
+	}
+	var used float64
+	for _, g := range rep.Groups {
+		used += g.UsedBasedTotal
+	}
+	if d := used - rep.UsedBasedTotal; d > 1e-6 || d < -1e-6 {
+		t.Errorf("got subtotals adding up to %.3f, want total %.3f", used, rep.UsedBasedTotal)
+	}
+}
@@ -0,0 +1,237 @@
+package sizing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/errgroup"
+)
+
+// RedisStats holds memory stats of a single Redis instance
+type RedisStats struct {
+	Addr      string
+	UsedBytes uint64
+	PeakBytes uint64
+
+	MaxmemoryBytes  uint64 `json:",omitempty"` // configured maxmemory, 0 if unknown or not set
+	MaxmemoryPolicy string `json:",omitempty"`
+	EvictedKeys     uint64 `json:",omitempty"`
+	KeyspaceHits    uint64 `json:",omitempty"`
+	KeyspaceMisses  uint64 `json:",omitempty"`
+
+	Prefixes []PrefixUsage `json:",omitempty"` // top key prefixes, only with deep scan
+
+	NodeType string            `json:",omitempty"` // current node type, only for ElastiCache nodes
+	Labels   map[string]string `json:",omitempty"`
+}
+
+// LabelsString returns labels formatted as comma-separated key=value pairs
+// sorted by key
+func (s RedisStats) LabelsString() string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + s.Labels[k]
+	}
+	return strings.Join(keys, ",")
+}
+
+// UsedGiB returns UsedBytes in GiB
+func (s RedisStats) UsedGiB() float64 { return float64(s.UsedBytes>>20) / 1024 }
+
+// PeakGiB returns PeakBytes in GiB
+func (s RedisStats) PeakGiB() float64 { return float64(s.PeakBytes>>20) / 1024 }
+
+// Evicting reports whether Redis evicted keys to stay within maxmemory limit
+func (s RedisStats) Evicting() bool { return s.EvictedKeys != 0 }
+
+// HitRatio returns percent of successful key lookups, or 0 if there were none
+func (s RedisStats) HitRatio() float64 {
+	if s.KeyspaceHits+s.KeyspaceMisses == 0 {
+		return 0
+	}
+	return float64(s.KeyspaceHits) / float64(s.KeyspaceHits+s.KeyspaceMisses) * 100
+}
+
+// HitRatioSize estimates how much memory evicting cache needs to reach target
+// hit ratio percent. It assumes that miss ratio is inversely proportional to
+// cache size, which is a rough, but common approximation for caches with
+// long-tailed key popularity. It returns false if there is not enough data
+// for an estimate.
+func (s RedisStats) HitRatioSize(target float64) (uint64, bool) {
+	if !s.Evicting() || s.KeyspaceHits+s.KeyspaceMisses == 0 || s.KeyspaceMisses == 0 {
+		return 0, false
+	}
+	missRatio := float64(s.KeyspaceMisses) / float64(s.KeyspaceHits+s.KeyspaceMisses)
+	targetMissRatio := 1 - target/100
+	return uint64(math.Round(float64(s.UsedBytes) * missRatio / targetMissRatio)), true
+}
+
+// Endpoint is a Redis address with optional credentials and TLS setting
+type Endpoint struct {
+	Addr     string // HOST:PORT
+	Username string // ACL user, Redis 6+
+	Password string // AUTH password or ElastiCache AUTH token
+	TLS      bool   // connect over TLS, verifying server certificate against host
+}
+
+func (e Endpoint) options() *redis.Options {
+	opts := &redis.Options{Addr: e.Addr, Username: e.Username, Password: e.Password}
+	if e.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return opts
+}
+
+// LiveStats connects to each of the Redis addresses and collects their memory
+// usage, querying at most 10 instances concurrently. If scan is not nil, it
+// is used to collect keyspace breakdown of each instance. Returned stats are
+// in the same order as addresses.
+func LiveStats(ctx context.Context, redises []string, scan *KeyspaceScan) ([]RedisStats, error) {
+	endpoints := make([]Endpoint, len(redises))
+	for i, addr := range redises {
+		endpoints[i] = Endpoint{Addr: addr}
+	}
+	return EndpointStats(ctx, endpoints, scan)
+}
+
+// EndpointStats is like LiveStats, but connects to endpoints with their
+// credentials and TLS settings.
+func EndpointStats(ctx context.Context, endpoints []Endpoint, scan *KeyspaceScan) ([]RedisStats, error) {
+	maxWorkers := len(endpoints)
+	const workerCap = 10
+	if maxWorkers > workerCap {
+		maxWorkers = workerCap
+	}
+	redisesInfo := make([]RedisStats, len(endpoints)) // preallocate for concurrent fill
+	type endpointAndIndex struct {
+		Endpoint
+		index int
+	}
+	jobs := make(chan endpointAndIndex)
+
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		defer close(jobs)
+		for i, ep := range endpoints {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case jobs <- endpointAndIndex{Endpoint: ep, index: i}:
+			}
+		}
+		return nil
+	})
+	for i := 0; i < maxWorkers; i++ {
+		group.Go(func() error {
+			for job := range jobs {
+				st, err := redisStats(ctx, job.Endpoint)
+				if err != nil {
+					return fmt.Errorf("%s: %w", job.Addr, err)
+				}
+				if scan != nil {
+					if st.Prefixes, err = scan.prefixes(ctx, job.Endpoint); err != nil {
+						return fmt.Errorf("%s: keyspace scan: %w", job.Addr, err)
+					}
+				}
+				redisesInfo[job.index] = st
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return redisesInfo, nil
+}
+
+func redisStats(ctx context.Context, ep Endpoint) (RedisStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	client := redis.NewClient(ep.options())
+	defer client.Close()
+	data, err := client.Info(ctx).Bytes()
+	if err != nil {
+		return RedisStats{}, err
+	}
+	st, err := ParseInfo(bytes.NewReader(data))
+	if err != nil {
+		return RedisStats{}, err
+	}
+	st.Addr = ep.Addr
+	if st.MaxmemoryPolicy == "" {
+		// older Redis versions don't report maxmemory settings in INFO;
+		// CONFIG may be disabled, so this is the best effort
+		if vals, err := client.ConfigGet(ctx, "maxmemory*").Result(); err == nil {
+			parseMaxmemoryConfig(&st, vals)
+		}
+	}
+	return st, nil
+}
+
+// parseMaxmemoryConfig sets maxmemory settings of st from CONFIG GET reply of
+// alternating parameter names and values
+func parseMaxmemoryConfig(st *RedisStats, vals []interface{}) {
+	for i := 0; i+1 < len(vals); i += 2 {
+		name, _ := vals[i].(string)
+		val, _ := vals[i+1].(string)
+		switch name {
+		case "maxmemory":
+			st.MaxmemoryBytes, _ = strconv.ParseUint(val, 10, 64)
+		case "maxmemory-policy":
+			st.MaxmemoryPolicy = val
+		}
+	}
+}
+
+// ParseInfo extracts memory and eviction related values from the output of
+// Redis INFO command. Returned RedisStats has its Addr field empty.
+func ParseInfo(rd io.Reader) (RedisStats, error) {
+	var st RedisStats
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		i := bytes.IndexByte(scanner.Bytes(), ':')
+		if i < 0 {
+			continue
+		}
+		name, val := string(scanner.Bytes()[:i]), string(scanner.Bytes()[i+1:])
+		var dst *uint64
+		switch name {
+		case "used_memory":
+			dst = &st.UsedBytes
+		case "used_memory_peak":
+			dst = &st.PeakBytes
+		case "maxmemory":
+			dst = &st.MaxmemoryBytes
+		case "evicted_keys":
+			dst = &st.EvictedKeys
+		case "keyspace_hits":
+			dst = &st.KeyspaceHits
+		case "keyspace_misses":
+			dst = &st.KeyspaceMisses
+		case "maxmemory_policy":
+			st.MaxmemoryPolicy = val
+			continue
+		default:
+			continue
+		}
+		var err error
+		if *dst, err = strconv.ParseUint(val, 10, 64); err != nil {
+			return RedisStats{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return st, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package sizing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseInfoEviction(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		info     string
+		want     RedisStats
+		evicting bool
+	}{
+		{
+			name: "evicting cache",
+			info: "# Memory\r\nused_memory:4294967296\r\nused_memory_peak:4294967296\r\nmaxmemory:4294967296\r\nmaxmemory_policy:allkeys-lru\r\n" +
+				"# Stats\r\nevicted_keys:5000\r\nkeyspace_hits:900\r\nkeyspace_misses:100\r\n",
+			want: RedisStats{UsedBytes: 4 * gib, PeakBytes: 4 * gib, MaxmemoryBytes: 4 * gib, MaxmemoryPolicy: "allkeys-lru",
+				EvictedKeys: 5000, KeyspaceHits: 900, KeyspaceMisses: 100},
+			evicting: true,
+		},
+		{
+			name: "not evicting cache",
+			info: "# Memory\r\nused_memory:1073741824\r\nused_memory_peak:2147483648\r\nmaxmemory:0\r\nmaxmemory_policy:noeviction\r\n" +
+				"# Stats\r\nevicted_keys:0\r\nkeyspace_hits:900\r\nkeyspace_misses:100\r\n",
+			want: RedisStats{UsedBytes: gib, PeakBytes: 2 * gib, MaxmemoryPolicy: "noeviction",
+				KeyspaceHits: 900, KeyspaceMisses: 100},
+		},
+		{
+			name: "no stats section",
+			info: "# Memory\r\nused_memory:1073741824\r\nused_memory_peak:1073741824\r\n",
+			want: RedisStats{UsedBytes: gib, PeakBytes: gib},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseInfo(strings.NewReader(tc.info))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UsedBytes != tc.want.UsedBytes || got.PeakBytes != tc.want.PeakBytes ||
+				got.MaxmemoryBytes != tc.want.MaxmemoryBytes || got.MaxmemoryPolicy != tc.want.MaxmemoryPolicy ||
+				got.EvictedKeys != tc.want.EvictedKeys || got.KeyspaceHits != tc.want.KeyspaceHits ||
+				got.KeyspaceMisses != tc.want.KeyspaceMisses {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if got.Evicting() != tc.evicting {
+				t.Errorf("got evicting %v, want %v", got.Evicting(), tc.evicting)
+			}
+		})
+	}
+
+	if _, err := ParseInfo(strings.NewReader("evicted_keys:many\r\n")); err == nil || !strings.HasPrefix(err.Error(), "evicted_keys: ") {
+		t.Errorf("got error %v, want one about evicted_keys", err)
+	}
+}
+
+func TestParseMaxmemoryConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		vals       []interface{}
+		wantBytes  uint64
+		wantPolicy string
+	}{
+		{
+			name:       "evicting cache",
+			vals:       []interface{}{"maxmemory", "4294967296", "maxmemory-policy", "allkeys-lru", "maxmemory-samples", "5"},
+			wantBytes:  4 * gib,
+			wantPolicy: "allkeys-lru",
+		},
+		{
+			name:       "no limit",
+			vals:       []interface{}{"maxmemory-policy", "noeviction", "maxmemory", "0"},
+			wantPolicy: "noeviction",
+		},
+		{
+			name: "odd reply",
+			vals: []interface{}{"maxmemory"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var st RedisStats
+			parseMaxmemoryConfig(&st, tc.vals)
+			if st.MaxmemoryBytes != tc.wantBytes || st.MaxmemoryPolicy != tc.wantPolicy {
+				t.Errorf("got %d, %q, want %d, %q", st.MaxmemoryBytes, st.MaxmemoryPolicy, tc.wantBytes, tc.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestHitRatioSize(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		st     RedisStats
+		target float64
+		want   uint64
+		ok     bool
+	}{
+		{
+			name:   "evicting cache",
+			st:     RedisStats{UsedBytes: 4 * gib, EvictedKeys: 5000, KeyspaceHits: 900, KeyspaceMisses: 100},
+			target: 95,
+			want:   8 * gib, // half the misses
+			ok:     true,
+		},
+		{
+			name:   "not evicting cache",
+			st:     RedisStats{UsedBytes: 4 * gib, KeyspaceHits: 900, KeyspaceMisses: 100},
+			target: 95,
+		},
+		{
+			name:   "zero misses",
+			st:     RedisStats{UsedBytes: 4 * gib, EvictedKeys: 5000, KeyspaceHits: 900},
+			target: 95,
+		},
+		{
+			name:   "no lookups",
+			st:     RedisStats{UsedBytes: 4 * gib, EvictedKeys: 5000},
+			target: 95,
+		},
+		{
+			name:   "target below current hit ratio",
+			st:     RedisStats{UsedBytes: 4 * gib, EvictedKeys: 5000, KeyspaceHits: 900, KeyspaceMisses: 100},
+			target: 80,
+			want:   2 * gib,
+			ok:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := tc.st.HitRatioSize(tc.target)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("got %d, %v, want %d, %v", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
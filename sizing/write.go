@@ -0,0 +1,613 @@
+package sizing
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteText writes report as a text table
+func WriteText(w io.Writer, rep Report) error {
+	tw := tabwriter.NewWriter(w, 1, 4, 1, ' ', 0)
+	defer tw.Flush()
+	rows := rep.Rows
+	withCurrent, withLabels, withOverrides := hasCurrent(rows), hasLabels(rows), rep.HasOverrides()
+	fmt.Fprintf(tw, "HOST\tUSED(LOAD)\tTYPE\t$/HR\t$/MONTH\tPEAK(LOAD)\tTYPE\t$/HR\t$/MONTH\t")
+	if withCurrent {
+		fmt.Fprintf(tw, "CURRENT\t$/MONTH\tSAVED(USED)\tSAVED(PEAK)\t")
+	}
+	if withOverrides {
+		fmt.Fprintf(tw, "MAX-LOAD\tRESERVED\tENGINE\t")
+	}
+	if withLabels {
+		fmt.Fprintf(tw, "LABELS\t")
+	}
+	fmt.Fprintln(tw)
+	for _, g := range rep.RowGroups() {
+		writeTextRows(tw, g.Rows, withCurrent, withLabels, withOverrides)
+		if rep.GroupBy == "" {
+			continue
+		}
+		fmt.Fprintf(tw, "= %s=%s\t\t\t\t%.3f\t\t\t\t%.3f\t", rep.GroupBy, g.Title(), g.UsedBasedTotal, g.PeakBasedTotal)
+		if withCurrent {
+			fmt.Fprintf(tw, "\t%.3f\t%.3f\t%.3f\t", g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal)
+		}
+		fmt.Fprintln(tw)
+	}
+	if rep.GroupBy == "" {
+		return tw.Flush()
+	}
+	fmt.Fprintf(tw, "\n%s\tREDISES\tUSED $/MONTH\tPEAK $/MONTH\t", strings.ToUpper(rep.GroupBy))
+	if withCurrent {
+		fmt.Fprintf(tw, "CURRENT $/MONTH\tSAVED(USED)\tSAVED(PEAK)\t")
+	}
+	fmt.Fprintln(tw)
+	for _, g := range rep.Groups {
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.3f\t", g.Title(), g.Redises, g.UsedBasedTotal, g.PeakBasedTotal)
+		if withCurrent {
+			fmt.Fprintf(tw, "%.3f\t%.3f\t%.3f\t", g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%.3f\t%.3f\t", len(rows), rep.UsedBasedTotal, rep.PeakBasedTotal)
+	if withCurrent {
+		fmt.Fprintf(tw, "%.3f\t%.3f\t%.3f\t", rep.CurrentTotal, rep.UsedSavingsTotal, rep.PeakSavingsTotal)
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+func writeTextRows(tw io.Writer, rows []ReportRow, withCurrent, withLabels, withOverrides bool) {
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%.1f (%.1f%%)\t%s\t%.3f\t%.3f\t%.1f (%.1f%%)\t%s\t%.3f\t%.3f\t", row.host(),
+			row.UsedGiB(), row.UsedRatio,
+			row.UsedBased.InstanceType, row.UsedBased.PricePerHour, row.UsedPricePerMonth(),
+			row.PeakGiB(), row.PeakRatio,
+			row.PeakBased.InstanceType, row.PeakBased.PricePerHour, row.PeakPricePerMonth(),
+		)
+		if withCurrent {
+			if row.Current != nil {
+				fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t", row.Current.InstanceType, row.CurrentPricePerMonth(),
+					row.UsedSavings(), row.PeakSavings())
+			} else {
+				fmt.Fprintf(tw, "-\t-\t-\t-\t")
+			}
+		}
+		if withOverrides {
+			fmt.Fprintf(tw, "%d%%\t%d%%\t%s\t", row.MaxLoad, row.ReservedMemoryPercent, row.Engine)
+		}
+		if withLabels {
+			fmt.Fprintf(tw, "%s\t", row.Redis.LabelsString())
+		}
+		fmt.Fprintln(tw)
+	}
+}
+
+// WriteMarkdown writes report as GitHub Flavored Markdown table, with the
+// same columns as WriteText, preceded by report parameters and followed by
+// footnotes
+func WriteMarkdown(w io.Writer, rep Report) error {
+	bw := bufio.NewWriter(w)
+	rows := rep.Rows
+	withCurrent, withLabels, withOverrides := hasCurrent(rows), hasLabels(rows), rep.HasOverrides()
+	fmt.Fprintf(bw, "Estimate on ElastiCache nodes required to cover Redis instances, based on memory readings from %s UTC.\n\n",
+		rep.Time.UTC().Format("2006-01-02 15:04"))
+	fmt.Fprintf(bw, "- Region: %s\n", rep.Region)
+	fmt.Fprintf(bw, "- Max memory load target: %d%%\n", rep.MaxLoad)
+	fmt.Fprintf(bw, "- `reserved-memory-percent`: %d[^maxmemory]\n", rep.ReservedMemoryPercent)
+	fmt.Fprintf(bw, "- Engine: %s\n", rep.engine())
+	if withOverrides {
+		fmt.Fprintln(bw, "\nRows with their own max load, reserved memory, or engine were matched with these instead.")
+	}
+	fmt.Fprintln(bw)
+
+	fmt.Fprint(bw, "| Host | Used GiB (load) | Type | $/hr | $/month | Peak GiB (load) | Type | $/hr | $/month |")
+	align := "| --- | ---: | --- | ---: | ---: | ---: | --- | ---: | ---: |"
+	if withCurrent {
+		fmt.Fprint(bw, " Current | $/month | Saved (used) | Saved (peak) |")
+		align += " --- | ---: | ---: | ---: |"
+	}
+	if withOverrides {
+		fmt.Fprint(bw, " Max load | Reserved | Engine |")
+		align += " ---: | ---: | --- |"
+	}
+	if withLabels {
+		fmt.Fprint(bw, " Labels |")
+		align += " --- |"
+	}
+	fmt.Fprintf(bw, "\n%s\n", align)
+	// emptyCells are trailing cells of subtotal and total rows
+	var emptyCells string
+	if withOverrides {
+		emptyCells += " | | |"
+	}
+	if withLabels {
+		emptyCells += " |"
+	}
+	for _, g := range rep.RowGroups() {
+		for _, row := range g.Rows {
+			host := markdownEscape(row.Redis.Addr)
+			if row.Nodes > 1 {
+				host += fmt.Sprintf(" (%d nodes)", row.Nodes)
+			}
+			switch {
+			case row.HitRatioBytes != 0:
+				host += " (sized for hit ratio[^evicting])"
+			case row.Redis.Evicting():
+				host += " (evicting[^evicting])"
+			}
+			fmt.Fprintf(bw, "| %s | %.1f (%.1f%%) | %s | %.3f | %.3f | %.1f (%.1f%%) | %s | %.3f | %.3f |", host,
+				row.UsedGiB(), row.UsedRatio,
+				row.UsedBased.InstanceType, row.UsedBased.PricePerHour, row.UsedPricePerMonth(),
+				row.PeakGiB(), row.PeakRatio,
+				row.PeakBased.InstanceType, row.PeakBased.PricePerHour, row.PeakPricePerMonth(),
+			)
+			if withCurrent {
+				if row.Current != nil {
+					fmt.Fprintf(bw, " %s | %.3f | %.3f | %.3f |", row.Current.InstanceType, row.CurrentPricePerMonth(),
+						row.UsedSavings(), row.PeakSavings())
+				} else {
+					fmt.Fprint(bw, " - | - | - | - |")
+				}
+			}
+			if withOverrides {
+				fmt.Fprintf(bw, " %d%% | %d%% | %s |", row.MaxLoad, row.ReservedMemoryPercent, row.Engine)
+			}
+			if withLabels {
+				fmt.Fprintf(bw, " %s |", markdownEscape(row.Redis.LabelsString()))
+			}
+			fmt.Fprintln(bw)
+		}
+		if rep.GroupBy == "" {
+			continue
+		}
+		fmt.Fprintf(bw, "| **Subtotal** %s=%s | | | | **%.3f** | | | | **%.3f** |",
+			markdownEscape(rep.GroupBy), markdownEscape(g.Title()), g.UsedBasedTotal, g.PeakBasedTotal)
+		if withCurrent {
+			fmt.Fprintf(bw, " | **%.3f** | **%.3f** | **%.3f** |", g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal)
+		}
+		fmt.Fprintf(bw, "%s\n", emptyCells)
+	}
+	fmt.Fprintf(bw, "| **Total** | | | | **%.3f** | | | | **%.3f** |", rep.UsedBasedTotal, rep.PeakBasedTotal)
+	if withCurrent {
+		fmt.Fprintf(bw, " | **%.3f** | **%.3f** | **%.3f** |", rep.CurrentTotal, rep.UsedSavingsTotal, rep.PeakSavingsTotal)
+	}
+	fmt.Fprintf(bw, "%s\n", emptyCells)
+
+	if rep.GroupBy != "" {
+		fmt.Fprintf(bw, "\nMonthly totals by %s label:\n\n", markdownEscape(rep.GroupBy))
+		fmt.Fprintf(bw, "| %s | Redises | Used $/month | Peak $/month |", markdownEscape(rep.GroupBy))
+		align := "| --- | ---: | ---: | ---: |"
+		if withCurrent {
+			fmt.Fprint(bw, " Current $/month | Saved (used) | Saved (peak) |")
+			align += " ---: | ---: | ---: |"
+		}
+		fmt.Fprintf(bw, "\n%s\n", align)
+		for _, g := range rep.Groups {
+			fmt.Fprintf(bw, "| %s | %d | %.3f | %.3f |", markdownEscape(g.Title()), g.Redises, g.UsedBasedTotal, g.PeakBasedTotal)
+			if withCurrent {
+				fmt.Fprintf(bw, " %.3f | %.3f | %.3f |", g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal)
+			}
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "| **Total** | **%d** | **%.3f** | **%.3f** |", len(rows), rep.UsedBasedTotal, rep.PeakBasedTotal)
+		if withCurrent {
+			fmt.Fprintf(bw, " **%.3f** | **%.3f** | **%.3f** |", rep.CurrentTotal, rep.UsedSavingsTotal, rep.PeakSavingsTotal)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	fmt.Fprintf(bw, "\n[^maxmemory]: Node types are matched by `maxmemory` target Redis values,"+
+		" derived from [node-specific list of maxmemory values](%s),"+
+		" corrected to ElastiCache-specific [`reserved-memory-percent`](%s) parameter.\n",
+		"https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.NodeSpecific",
+		"https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.3-2-4.New")
+	if rep.HasEvicting() {
+		fmt.Fprint(bw, "\n[^evicting]: Caches marked as evicting have removed keys to stay within their"+
+			" `maxmemory` limit, so their used and peak memory only reflects that limit,"+
+			" not the size of the data set their clients ask for.")
+		if rep.TargetHitRatio != 0 {
+			fmt.Fprintf(bw, " Caches sized for hit ratio are matched for the memory estimated to reach %g%% hit ratio,"+
+				" assuming miss ratio is inversely proportional to cache size.", rep.TargetHitRatio)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// markdownEscape escapes characters breaking Markdown table cells or
+// formatting
+var markdownEscape = strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`").Replace
+
+// WriteCSV writes report as CSV, with a header row and a total row. Grouped
+// report also has subtotal rows and a table of groups, all with the same
+// number of columns.
+func WriteCSV(w io.Writer, rep Report) error {
+	wr := csv.NewWriter(w)
+	defer wr.Flush()
+	csvRow := []string{"host",
+		"used memory (gib)", "instance type (use-based)",
+		"instance memory (use-based)", "usd/month (use-based)",
+		"peak memory (gib)", "instance type (peak-based)",
+		"instance memory (peak-based)", "usd/month (peak-based)",
+		"evicted keys", "hit ratio (%)", "sized for hit ratio",
+		"current instance type", "usd/month (current)",
+		"usd/month saved (use-based)", "usd/month saved (peak-based)",
+		"max load (%)", "reserved memory (%)", "engine",
+		"labels", "nodes",
+	}
+	if err := wr.Write(csvRow); err != nil {
+		return err
+	}
+	for _, g := range rep.RowGroups() {
+		if err := writeCSVRows(wr, csvRow, g.Rows); err != nil {
+			return err
+		}
+		if rep.GroupBy == "" {
+			continue
+		}
+		if err := writeCSVTotals(wr, csvRow, "subtotal "+rep.GroupBy+"="+g.Title(), g.UsedBasedTotal, g.PeakBasedTotal,
+			g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal); err != nil {
+			return err
+		}
+	}
+	if err := writeCSVTotals(wr, csvRow, "total", rep.UsedBasedTotal, rep.PeakBasedTotal,
+		rep.CurrentTotal, rep.UsedSavingsTotal, rep.PeakSavingsTotal); err != nil {
+		return err
+	}
+	if rep.GroupBy != "" {
+		// group summary follows an empty row, with as many columns as
+		// the rows above have
+		columns := len(csvRow)
+		csvRow = csvRow[:0]
+		for len(csvRow) != columns {
+			csvRow = append(csvRow, "")
+		}
+		if err := wr.Write(csvRow); err != nil {
+			return err
+		}
+		withCurrent := rep.HasCurrent()
+		csvRow = append(csvRow[:0], rep.GroupBy, "redises", "usd/month (use-based)", "usd/month (peak-based)")
+		if withCurrent {
+			csvRow = append(csvRow, "usd/month (current)", "usd/month saved (use-based)", "usd/month saved (peak-based)")
+		}
+		for len(csvRow) != columns {
+			csvRow = append(csvRow, "")
+		}
+		if err := wr.Write(csvRow); err != nil {
+			return err
+		}
+		for _, g := range rep.Groups {
+			csvRow = append(csvRow[:0], g.Title(), strconv.Itoa(g.Redises),
+				strconv.FormatFloat(g.UsedBasedTotal, 'f', 3, 64),
+				strconv.FormatFloat(g.PeakBasedTotal, 'f', 3, 64),
+			)
+			if withCurrent {
+				csvRow = append(csvRow,
+					strconv.FormatFloat(g.CurrentTotal, 'f', 3, 64),
+					strconv.FormatFloat(g.UsedSavingsTotal, 'f', 3, 64),
+					strconv.FormatFloat(g.PeakSavingsTotal, 'f', 3, 64),
+				)
+			}
+			for len(csvRow) != columns {
+				csvRow = append(csvRow, "")
+			}
+			if err := wr.Write(csvRow); err != nil {
+				return err
+			}
+		}
+	}
+	wr.Flush()
+	return wr.Error()
+}
+
+// writeCSVTotals writes subtotal or total row, which only fills usd/month
+// columns
+func writeCSVTotals(wr *csv.Writer, csvRow []string, title string, used, peak, current, usedSaved, peakSaved float64) error {
+	csvRow = append(csvRow[:0], title, "", "", "",
+		strconv.FormatFloat(used, 'f', 3, 64), "", "", "",
+		strconv.FormatFloat(peak, 'f', 3, 64), "", "", "", "")
+	if current != 0 {
+		csvRow = append(csvRow,
+			strconv.FormatFloat(current, 'f', 3, 64),
+			strconv.FormatFloat(usedSaved, 'f', 3, 64),
+			strconv.FormatFloat(peakSaved, 'f', 3, 64),
+		)
+	} else {
+		csvRow = append(csvRow, "", "", "")
+	}
+	csvRow = append(csvRow, "", "", "", "", "")
+	return wr.Write(csvRow)
+}
+
+func writeCSVRows(wr *csv.Writer, csvRow []string, rows []ReportRow) error {
+	for _, row := range rows {
+		csvRow = append(csvRow[:0], row.Redis.Addr,
+			strconv.FormatFloat(row.UsedGiB(), 'f', 2, 64),
+			row.UsedBased.InstanceType,
+			strconv.FormatFloat(row.UsedBased.MemoryGiB(), 'f', 2, 64),
+			strconv.FormatFloat(row.UsedPricePerMonth(), 'f', 3, 64),
+			strconv.FormatFloat(row.PeakGiB(), 'f', 2, 64),
+			row.PeakBased.InstanceType,
+			strconv.FormatFloat(row.PeakBased.MemoryGiB(), 'f', 2, 64),
+			strconv.FormatFloat(row.PeakPricePerMonth(), 'f', 3, 64),
+			strconv.FormatUint(row.Redis.EvictedKeys, 10),
+			strconv.FormatFloat(row.Redis.HitRatio(), 'f', 2, 64),
+			strconv.FormatBool(row.HitRatioBytes != 0),
+		)
+		if row.Current != nil {
+			csvRow = append(csvRow, row.Current.InstanceType,
+				strconv.FormatFloat(row.CurrentPricePerMonth(), 'f', 3, 64),
+				strconv.FormatFloat(row.UsedSavings(), 'f', 3, 64),
+				strconv.FormatFloat(row.PeakSavings(), 'f', 3, 64),
+			)
+		} else {
+			csvRow = append(csvRow, "", "", "", "")
+		}
+		csvRow = append(csvRow, strconv.Itoa(row.MaxLoad), strconv.Itoa(row.ReservedMemoryPercent), row.Engine,
+			row.Redis.LabelsString(), strconv.Itoa(row.NodeCount()))
+		if err := wr.Write(csvRow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes report as JSON
+func WriteJSON(w io.Writer, rep Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(rep)
+}
+
+// WriteHTML writes report as HTML page
+func WriteHTML(w io.Writer, rep Report) error {
+	return pageTemplate.Execute(w, rep)
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!doctype html><head><meta charset="utf-8">
+<title>Redis instances matched to ElastiCache Redis instances</title>
+<style>
+	html {line-height: 1.3; font-family: ui-serif, serif;}
+	table, code {font-family: ui-monospace, monospace;}
+	caption {padding:1em; caption-side: top; font-weight: bold; font-family: ui-sans-serif, sans-serif;}
+	th, td {padding: 0.1rem .5rem;}
+	td {white-space: nowrap;}
+	th {vertical-align: middle; text-align: center; background-color: #eee;}
+	tr:nth-child(even) td {background-color: #f8f8f8;}
+	tr:hover td {background-color: #eee;}
+	.right {text-align: right;}
+	.warn {text-color: darkred;}
+	tfoot td, .subtotal td {font-weight: bold;}
+	#footnote, #evicting {max-width:50em;}
+</style>
+</head>
+<body>
+<table>
+<caption>Estimate on ElastiCache instances required to cover Redis instances<br>
+based on memory readings from {{.Time.Format "2006-01-02 15:04"}} UTC,<br>
+using {{.MaxLoad}}% <a href="#footnote">max memory load target</a><sup>*</sup>
+and <code>reserved-memory-percent={{.ReservedMemoryPercent}}</code>{{if .HasOverrides}}
+unless overridden per instance{{end}},<br>
+prices are for on-demand {{with .Engine}}{{.}} {{end}}nodes in {{.Region}} region
+</caption>
+<thead>
+<tr>
+	<th rowspan=2>Redis instance</th>
+	<th rowspan=2>Used, GiB</th>
+	<th rowspan=2>Peak, GiB</th>
+	<th colspan=5>Based on used memory</th>
+	<th colspan=5>Based on peak memory</th>
+	{{if .HasCurrent}}<th colspan=4>Current node</th>{{end}}
+	{{if .HasOverrides}}<th rowspan=2>Max load, %</th><th rowspan=2>Reserved memory, %</th><th rowspan=2>Engine</th>{{end}}
+</tr>
+<tr>
+	<!-- 3 columns skipped -->
+	<!-- based on used memory -->
+	<th>Node type</th>
+	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
+	<th>Load, %</th>
+	<th>USD<wbr>/hour</th>
+	<th>USD<wbr>/month</th>
+	<!-- based on peak memory -->
+	<th>Node type</th>
+	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
+	<th>Load, %</th>
+	<th>USD<wbr>/hour</th>
+	<th>USD<wbr>/month</th>
+	{{if .HasCurrent}}
+	<!-- current node -->
+	<th>Node type</th>
+	<th>USD<wbr>/month</th>
+	<th>Saved USD<wbr>/month, used-based</th>
+	<th>Saved USD<wbr>/month, peak-based</th>
+	{{end}}
+</tr>
+</thead>
+{{$withCurrent := .HasCurrent}}{{$withOverrides := .HasOverrides}}
+{{range .RowGroups}}
+<tbody>
+{{range .Rows}}
+<tr>
+	<td>{{.Redis.Addr}}{{if gt .Nodes 1}} ({{.Nodes}} nodes){{end}}{{with .Redis.LabelsString}}<br><small>{{.}}</small>{{end}}{{if .HitRatioBytes}} <a href="#evicting">sized for hit ratio</a>{{else if .Redis.Evicting}} <a href="#evicting" class="warn">evicting</a>{{end}}</td><!-- instance address -->
+	<td class="right">{{printf "%.1f" .UsedGiB}}</td><!-- used memory, GiB -->
+	<td class="right">{{printf "%.1f" .PeakGiB}}</td><!-- peak memory, GiB -->
+	<!-- based on used memory -->
+	<td>{{.UsedBased.InstanceType}}</td>
+	<td class="right">{{printf "%.1f" .UsedBased.MemoryGiB}}</td>
+	<td class="right{{if ge .UsedRatio 95.0}} warn{{end}}">{{printf "%.1f" .UsedRatio}}</td>
+	<td class="right">{{printf "%.3f" .UsedBased.PricePerHour}}</td>
+	<td class="right">{{printf "%.3f" .UsedPricePerMonth}}</td>
+	<!-- based on peak memory -->
+	<td>{{.PeakBased.InstanceType}}</td>
+	<td class="right">{{printf "%.1f" .PeakBased.MemoryGiB}}</td>
+	<td class="right{{if ge .PeakRatio 95.0}} warn{{end}}">{{printf "%.1f" .PeakRatio}}</td>
+	<td class="right">{{printf "%.3f" .PeakBased.PricePerHour}}</td>
+	<td class="right">{{printf "%.3f" .PeakPricePerMonth}}</td>
+	{{if $withCurrent}}
+	<!-- current node -->
+	{{if .Current}}<td>{{.Current.InstanceType}}</td>
+	<td class="right">{{printf "%.3f" .CurrentPricePerMonth}}</td>{{else}}<td></td><td></td>{{end}}
+	<td class="right">{{if .Current}}{{printf "%.3f" .UsedSavings}}{{end}}</td>
+	<td class="right">{{if .Current}}{{printf "%.3f" .PeakSavings}}{{end}}</td>
+	{{end}}
+	{{if $withOverrides}}
+	<td class="right">{{.MaxLoad}}</td>
+	<td class="right">{{.ReservedMemoryPercent}}</td>
+	<td>{{.Engine}}</td>
+	{{end}}
+</tr>
+{{end}}
+{{if $.GroupBy}}
+<tr class="subtotal">
+	<th scope="row" colspan=7>Subtotal, <code>{{$.GroupBy}}={{.Title}}</code></th>
+	<td class="right">{{printf "%.3f" .UsedBasedTotal}}</td>
+	<th colspan=4></th>
+	<td class="right">{{printf "%.3f" .PeakBasedTotal}}</td>
+	{{if $withCurrent}}
+	<th></th>
+	<td class="right">{{printf "%.3f" .CurrentTotal}}</td>
+	<td class="right">{{printf "%.3f" .UsedSavingsTotal}}</td>
+	<td class="right">{{printf "%.3f" .PeakSavingsTotal}}</td>
+	{{end}}
+	{{if $withOverrides}}<th colspan=3></th>{{end}}
+</tr>
+{{end}}
+</tbody>
+{{end}}
+<tfoot>
+<tr>
+	<th scope="row" colspan=3>Totals</th>
+	<th scope="row" colspan=4>Based on used memory, USD / month</th>
+	<td class="right">{{printf "%.3f" .UsedBasedTotal}}</td>
+	<th scope="row" colspan=4>Based on peak memory, USD / month</th>
+	<td class="right">{{printf "%.3f" .PeakBasedTotal}}</td>
+	{{if .HasCurrent}}
+	<th scope="row">Current, USD / month</th>
+	<td class="right">{{printf "%.3f" .CurrentTotal}}</td>
+	<td class="right">{{printf "%.3f" .UsedSavingsTotal}}</td>
+	<td class="right">{{printf "%.3f" .PeakSavingsTotal}}</td>
+	{{end}}
+	{{if .HasOverrides}}<th colspan=3></th>{{end}}
+</tr>
+</tfoot>
+</table>
+{{if .GroupBy}}
+<table>
+<caption>Monthly totals by <code>{{.GroupBy}}</code> label</caption>
+<thead>
+<tr>
+	<th><code>{{.GroupBy}}</code></th>
+	<th>Redis instances</th>
+	<th>Based on used memory, USD<wbr>/month</th>
+	<th>Based on peak memory, USD<wbr>/month</th>
+	{{if .HasCurrent}}
+	<th>Current, USD<wbr>/month</th>
+	<th>Saved USD<wbr>/month, used-based</th>
+	<th>Saved USD<wbr>/month, peak-based</th>
+	{{end}}
+</tr>
+</thead>
+<tbody>
+{{range .Groups}}
+<tr>
+	<td>{{.Title}}</td>
+	<td class="right">{{.Redises}}</td>
+	<td class="right">{{printf "%.3f" .UsedBasedTotal}}</td>
+	<td class="right">{{printf "%.3f" .PeakBasedTotal}}</td>
+	{{if $withCurrent}}
+	<td class="right">{{printf "%.3f" .CurrentTotal}}</td>
+	<td class="right">{{printf "%.3f" .UsedSavingsTotal}}</td>
+	<td class="right">{{printf "%.3f" .PeakSavingsTotal}}</td>
+	{{end}}
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+{{if .HasCandidates}}
+<table>
+<caption>Cheapest node types fitting each Redis instance</caption>
+<thead>
+<tr>
+	<th rowspan=2>Redis instance</th>
+	<th colspan=4>Based on used memory</th>
+	<th colspan=4>Based on peak memory</th>
+</tr>
+<tr>
+	<th>Node type</th>
+	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
+	<th>Load, %</th>
+	<th>USD<wbr>/month</th>
+	<th>Node type</th>
+	<th>Node size, <a href="#footnote">GiB</a><sup>*</sup></th>
+	<th>Load, %</th>
+	<th>USD<wbr>/month</th>
+</tr>
+</thead>
+{{range .Rows}}
+<tbody>
+{{$addr := .Redis.Addr}}{{$peak := .PeakCandidates}}
+{{range $i, $c := .UsedCandidates}}
+<tr>
+	<td>{{if not $i}}{{$addr}}{{end}}</td>
+	<td>{{.InstanceType}}</td>
+	<td class="right">{{printf "%.1f" .MemoryGiB}}</td>
+	<td class="right">{{printf "%.1f" .Load}}</td>
+	<td class="right">{{printf "%.3f" .PricePerMonth}}</td>
+	{{if lt $i (len $peak)}}{{with index $peak $i}}
+	<td>{{.InstanceType}}</td>
+	<td class="right">{{printf "%.1f" .MemoryGiB}}</td>
+	<td class="right">{{printf "%.1f" .Load}}</td>
+	<td class="right">{{printf "%.3f" .PricePerMonth}}</td>
+	{{end}}{{else}}<td></td><td></td><td></td><td></td>{{end}}
+</tr>
+{{end}}
+</tbody>
+{{end}}
+</table>
+{{end}}
+{{if .HasPrefixes}}
+<table>
+<caption>Top key prefixes by estimated memory usage, based on sampled <code>MEMORY USAGE</code></caption>
+<thead>
+<tr>
+	<th>Redis instance</th>
+	<th>Key prefix</th>
+	<th>Keys</th>
+	<th>Memory, GiB</th>
+	<th>Share, %</th>
+</tr>
+</thead>
+<tbody>
+{{range .Rows}}{{$addr := .Redis.Addr}}{{range .Redis.Prefixes}}
+<tr>
+	<td>{{$addr}}</td>
+	<td><code>{{.Prefix}}</code></td>
+	<td class="right">{{.Keys}}</td>
+	<td class="right">{{printf "%.2f" .GiB}}</td>
+	<td class="right">{{printf "%.1f" .Share}}</td>
+</tr>
+{{end}}{{end}}
+</tbody>
+</table>
+{{end}}
+<footer><p id="footnote"><sup>*</sup> Node sizes displays
+<code>maxmemory</code> target Redis values, derived from
+<a href="https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.NodeSpecific">node-specific list of maxmemory values</a>, corrected to ElastiCache-specific <a href="https://docs.aws.amazon.com/AmazonElastiCache/latest/red-ug/ParameterGroups.Redis.html#ParameterGroups.Redis.3-2-4.New"><code>reserved-memory-percent={{.ReservedMemoryPercent}}</code> parameter</a>.
+</p>
+{{if .HasEvicting}}<p id="evicting">Caches marked as evicting have removed keys to stay within their
+<code>maxmemory</code> limit, so their used and peak memory only reflects that
+limit, not the size of the data set their clients ask for.
+{{if .TargetHitRatio}}Caches sized for hit ratio are matched for the memory
+estimated to reach {{.TargetHitRatio}}% hit ratio, assuming miss ratio is
+inversely proportional to cache size.{{end}}</p>{{end}}
+</footer>
+</body>
+`))
@@ -0,0 +1,103 @@
+package sizing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteCSVGroups(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteCSV(buf, NewReport(testGroupRows(), "team")); err != nil {
+		t.Fatal(err)
+	}
+	// reader fails on rows with a different number of columns
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first []string
+	for _, rec := range records {
+		first = append(first, rec[0])
+	}
+	if want := []string{"host",
+		"a-1:6379", "subtotal team=a",
+		"b-1:6379", "b-2:6379", "subtotal team=b",
+		"none:6379", "subtotal team=(none)",
+		"total", "",
+		"team", "a", "b", "(none)",
+	}; !reflect.DeepEqual(first, want) {
+		t.Fatalf("got rows\n%q\nwant\n%q", first, want)
+	}
+	for _, tc := range []struct {
+		row  int
+		want []string // leading columns
+	}{
+		{2, []string{"subtotal team=a", "", "", "", "321.408", "", "", "", "321.408", "", "", "", "", "641.328", "319.920", "319.920", ""}},
+		{5, []string{"subtotal team=b", "", "", "", "481.368", "", "", "", "481.368", "", "", "", "", "", "", "", ""}},
+		{8, []string{"total", "", "", "", "963.480", "", "", "", "1123.440", "", "", "", "", "641.328", "319.920", "319.920", ""}},
+		{10, []string{"team", "redises", "usd/month (use-based)", "usd/month (peak-based)",
+			"usd/month (current)", "usd/month saved (use-based)", "usd/month saved (peak-based)", ""}},
+		{11, []string{"a", "1", "321.408", "321.408", "641.328", "319.920", "319.920", ""}},
+		{13, []string{"(none)", "1", "160.704", "320.664", "0.000", "0.000", "0.000", ""}},
+	} {
+		if got := records[tc.row][:len(tc.want)]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("row %d: got\n%q\nwant\n%q", tc.row, got, tc.want)
+		}
+	}
+}
+
+func TestWriteCSVTotal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteCSV(buf, NewReport(testGroupRows()[:2], "")); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d rows, want header, two rows and total", len(records))
+	}
+	want := []string{"total", "", "", "", "321.408", "", "", "", "481.368", "", "", "", "", "", "", "", "", "", "", "", ""}
+	if got := records[3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got total row\n%q\nwant\n%q", got, want)
+	}
+}
+
+// TestWriteMarkdown compares grouped report having pipes in host and label
+// values, and a cache sized for hit ratio, with testdata/report.md
+func TestWriteMarkdown(t *testing.T) {
+	rows := testGroupRows()
+	for i := range rows {
+		rows[i].MaxLoad, rows[i].ReservedMemoryPercent, rows[i].Engine = 80, 25, DefaultEngine
+	}
+	rows[0].Redis.Addr = "b|1:6379"
+	rows[1].Redis.EvictedKeys = 100
+	rows[1].Redis.UsedBytes, rows[1].Redis.PeakBytes = 4*gib, 4*gib
+	rows[1].HitRatioBytes = 8 * gib
+	rows[1].UsedRatio, rows[1].PeakRatio = 76.1, 37.8
+	rows[2].Redis.Labels["team"] = "a|x"
+	rows[3].Redis.Labels["env"] = "prod|eu"
+	rep := NewReport(rows, "team")
+	rep.Time = time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	rep.Region = "US East (N. Virginia)"
+	rep.MaxLoad = 80
+	rep.ReservedMemoryPercent = 25
+	rep.TargetHitRatio = 95
+	buf := new(bytes.Buffer)
+	if err := WriteMarkdown(buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,325 @@
+package sizing
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteXLSX writes report as XLSX spreadsheet of three sheets: report rows,
+// parameters, and offerings. Monthly prices and totals are formulas
+// referencing hours per month on the parameters sheet, so they can be
+// adjusted in the spreadsheet. Offerings sheet lists ofs, i.e. ones report
+// was matched to with report engine and reserved-memory-percent.
+func WriteXLSX(w io.Writer, rep Report, ofs Offerings) error {
+	sheets := []xlsxSheet{
+		xlsxReportSheet(rep),
+		xlsxParametersSheet(rep),
+		xlsxOfferingsSheet(ofs),
+	}
+	parts := []xlsxPart{
+		{"[Content_Types].xml", func(w io.Writer) error { return xlsxContentTypes(w, len(sheets)) }},
+		{"_rels/.rels", func(w io.Writer) error { _, err := io.WriteString(w, xlsxRootRels); return err }},
+		{"xl/workbook.xml", func(w io.Writer) error { return xlsxWorkbook(w, sheets) }},
+		{"xl/_rels/workbook.xml.rels", func(w io.Writer) error { return xlsxWorkbookRels(w, len(sheets)) }},
+		{"xl/styles.xml", func(w io.Writer) error { _, err := io.WriteString(w, xlsxStyles); return err }},
+	}
+	for i, s := range sheets {
+		parts = append(parts, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s.write})
+	}
+	zw := zip.NewWriter(w)
+	for _, p := range parts {
+		fw, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if err := p.write(fw); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// hoursCell is the absolute reference to hours per month on the parameters
+// sheet, see xlsxParametersSheet
+const hoursCell = "Parameters!$B$2"
+
+func xlsxReportSheet(rep Report) xlsxSheet {
+	s := xlsxSheet{
+		name:   "Report",
+		widths: []float64{32, 10, 18, 10, 10, 12, 10, 18, 10, 10, 12, 10, 10, 10, 18, 10, 12, 12, 12, 10, 10, 8, 32, 8},
+	}
+	s.rows = append(s.rows, xlsxHeader("Redis instance",
+		"Used, GiB", "Node type (used-based)", "Node size, GiB (used-based)", "USD/hour (used-based)", "USD/month (used-based)",
+		"Peak, GiB", "Node type (peak-based)", "Node size, GiB (peak-based)", "USD/hour (peak-based)", "USD/month (peak-based)",
+		"Evicted keys", "Hit ratio, %", "Sized for hit ratio",
+		"Current node type", "USD/hour (current)", "USD/month (current)",
+		"Saved USD/month (used-based)", "Saved USD/month (peak-based)",
+		"Max load, %", "Reserved memory, %", "Engine", "Labels", "Nodes"))
+	// columns of monthly prices and savings, which are subtotaled
+	const usedMonth, peakMonth, currentMonth, usedSaved, peakSaved = 5, 10, 16, 17, 18
+	totals := func(title string, first, last int, used, peak, current, usedSavings, peakSavings float64) []xlsxCell {
+		cells := make([]xlsxCell, 19)
+		cells[0] = xlsxCell{value: title, style: xlsxBold}
+		for col, v := range map[int]float64{usedMonth: used, peakMonth: peak,
+			currentMonth: current, usedSaved: usedSavings, peakSaved: peakSavings} {
+			c := xlsxColumn(col)
+			cells[col] = xlsxCell{value: v, style: xlsxBoldPrice,
+				formula: fmt.Sprintf("SUBTOTAL(9,%s%d:%s%d)", c, first, c, last)}
+		}
+		return cells
+	}
+	first := 2 // first row of report rows, 1-based
+	for _, g := range rep.RowGroups() {
+		groupFirst := len(s.rows) + 1
+		for _, row := range g.Rows {
+			n := len(s.rows) + 1
+			// monthly prices are for all nodes, see the Nodes column
+			month := func(hourCol string) string { return fmt.Sprintf("%s%d*%s*X%d", hourCol, n, hoursCell, n) }
+			cells := []xlsxCell{
+				{value: row.Redis.Addr},
+				{value: row.UsedGiB(), style: xlsxDecimal},
+				{value: row.UsedBased.InstanceType},
+				{value: row.UsedBased.MemoryGiB(), style: xlsxDecimal},
+				{value: row.UsedBased.PricePerHour, style: xlsxPrice},
+				{value: row.UsedPricePerMonth(), style: xlsxPrice, formula: month("E")},
+				{value: row.PeakGiB(), style: xlsxDecimal},
+				{value: row.PeakBased.InstanceType},
+				{value: row.PeakBased.MemoryGiB(), style: xlsxDecimal},
+				{value: row.PeakBased.PricePerHour, style: xlsxPrice},
+				{value: row.PeakPricePerMonth(), style: xlsxPrice, formula: month("J")},
+				{value: float64(row.Redis.EvictedKeys)},
+				{value: row.Redis.HitRatio(), style: xlsxDecimal},
+				{value: row.HitRatioBytes != 0},
+			}
+			if row.Current != nil {
+				cells = append(cells,
+					xlsxCell{value: row.Current.InstanceType},
+					xlsxCell{value: row.Current.PricePerHour, style: xlsxPrice},
+					xlsxCell{value: row.CurrentPricePerMonth(), style: xlsxPrice, formula: month("P")},
+					xlsxCell{value: row.UsedSavings(), style: xlsxPrice, formula: fmt.Sprintf("Q%d-F%d", n, n)},
+					xlsxCell{value: row.PeakSavings(), style: xlsxPrice, formula: fmt.Sprintf("Q%d-K%d", n, n)},
+				)
+			} else {
+				cells = append(cells, make([]xlsxCell, 5)...)
+			}
+			cells = append(cells,
+				xlsxCell{value: float64(row.MaxLoad)},
+				xlsxCell{value: float64(row.ReservedMemoryPercent)},
+				xlsxCell{value: row.Engine},
+				xlsxCell{value: row.Redis.LabelsString()},
+				xlsxCell{value: float64(row.NodeCount())},
+			)
+			s.rows = append(s.rows, cells)
+		}
+		if rep.GroupBy == "" {
+			continue
+		}
+		s.rows = append(s.rows, totals("Subtotal "+rep.GroupBy+"="+g.Title(), groupFirst, len(s.rows),
+			g.UsedBasedTotal, g.PeakBasedTotal, g.CurrentTotal, g.UsedSavingsTotal, g.PeakSavingsTotal))
+	}
+	// SUBTOTAL skips cells of nested subtotals, so group subtotal rows are
+	// not counted twice
+	s.rows = append(s.rows, totals("Total", first, len(s.rows),
+		rep.UsedBasedTotal, rep.PeakBasedTotal, rep.CurrentTotal, rep.UsedSavingsTotal, rep.PeakSavingsTotal))
+	return s
+}
+
+func xlsxParametersSheet(rep Report) xlsxSheet {
+	s := xlsxSheet{name: "Parameters", widths: []float64{36, 24}}
+	s.rows = append(s.rows,
+		xlsxHeader("Parameter", "Value"),
+		// must stay at B2, see hoursCell
+		[]xlsxCell{{value: "Hours per month"}, {value: float64(HoursPerMonth)}},
+		[]xlsxCell{{value: "Region"}, {value: rep.Region}},
+		[]xlsxCell{{value: "Memory readings time, UTC"}, {value: rep.Time.UTC().Format("2006-01-02 15:04")}},
+		[]xlsxCell{{value: "Max memory load, %"}, {value: float64(rep.MaxLoad)}},
+		[]xlsxCell{{value: "reserved-memory-percent"}, {value: float64(rep.ReservedMemoryPercent)}},
+		[]xlsxCell{{value: "Engine"}, {value: rep.engine()}},
+	)
+	if rep.TargetHitRatio != 0 {
+		s.rows = append(s.rows, []xlsxCell{{value: "Target hit ratio, %"}, {value: rep.TargetHitRatio}})
+	}
+	return s
+}
+
+func xlsxOfferingsSheet(ofs Offerings) xlsxSheet {
+	s := xlsxSheet{name: "Offerings", widths: []float64{20, 10, 12, 10, 12}}
+	s.rows = append(s.rows, xlsxHeader("Node type", "Family", "Memory, GiB", "USD/hour", "USD/month"))
+	for _, o := range ofs {
+		n := len(s.rows) + 1
+		s.rows = append(s.rows, []xlsxCell{
+			{value: o.InstanceType},
+			{value: o.Family()},
+			{value: o.MemoryGiB(), style: xlsxDecimal},
+			{value: o.PricePerHour, style: xlsxPrice},
+			{value: o.PricePerMonth(), style: xlsxPrice, formula: fmt.Sprintf("D%d*%s", n, hoursCell)},
+		})
+	}
+	return s
+}
+
+// Cell styles, indexes of cellXfs in xlsxStyles
+const (
+	xlsxDefault = iota
+	xlsxBold
+	xlsxDecimal
+	xlsxPrice
+	xlsxBoldPrice
+)
+
+// xlsxPart is a single file of XLSX zip archive
+type xlsxPart struct {
+	name  string
+	write func(io.Writer) error
+}
+
+type xlsxCell struct {
+	value   interface{} // string, float64, bool, or nil for empty cell
+	formula string      // value is then the cached result
+	style   int
+}
+
+type xlsxSheet struct {
+	name   string
+	widths []float64 // column widths, in characters
+	rows   [][]xlsxCell
+}
+
+func xlsxHeader(titles ...string) []xlsxCell {
+	cells := make([]xlsxCell, len(titles))
+	for i, t := range titles {
+		cells[i] = xlsxCell{value: t, style: xlsxBold}
+	}
+	return cells
+}
+
+// xlsxColumn returns name of 0-based column index, i.e. "A" for 0, "AA" for 26
+func xlsxColumn(i int) string {
+	var name []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+func (s xlsxSheet) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// freeze the header row
+	bw.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(s.widths) != 0 {
+		bw.WriteString("<cols>")
+		for i, width := range s.widths {
+			fmt.Fprintf(bw, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		bw.WriteString("</cols>")
+	}
+	bw.WriteString("<sheetData>")
+	for i, row := range s.rows {
+		fmt.Fprintf(bw, `<row r="%d">`, i+1)
+		for j, c := range row {
+			if c.value == nil && c.formula == "" {
+				continue
+			}
+			fmt.Fprintf(bw, `<c r="%s%d"`, xlsxColumn(j), i+1)
+			if c.style != xlsxDefault {
+				fmt.Fprintf(bw, ` s="%d"`, c.style)
+			}
+			switch v := c.value.(type) {
+			case string:
+				bw.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+				xml.EscapeText(bw, []byte(v))
+				bw.WriteString("</t></is></c>")
+			case bool:
+				b := "0"
+				if v {
+					b = "1"
+				}
+				fmt.Fprintf(bw, ` t="b"><v>%s</v></c>`, b)
+			case float64:
+				bw.WriteString(">")
+				if c.formula != "" {
+					bw.WriteString("<f>")
+					xml.EscapeText(bw, []byte(c.formula))
+					bw.WriteString("</f>")
+				}
+				fmt.Fprintf(bw, "<v>%s</v></c>", strconv.FormatFloat(v, 'g', -1, 64))
+			default:
+				return fmt.Errorf("unsupported value type %T of %s cell %s%d", c.value, s.name, xlsxColumn(j), i+1)
+			}
+		}
+		bw.WriteString("</row>")
+	}
+	bw.WriteString("</sheetData></worksheet>")
+	return bw.Flush()
+}
+
+func xlsxContentTypes(w io.Writer, sheets int) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func xlsxWorkbook(w io.Writer, sheets []xlsxSheet) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, s.name, i+1, i+1)
+	}
+	// cached formula values are written, but make sure spreadsheet
+	// applications recalculate them
+	b.WriteString(`</sheets><calcPr fullCalcOnLoad="1"/></workbook>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func xlsxWorkbookRels(w io.Writer, sheets int) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles cellXfs order must match xlsxDefault and other style constants
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="0.0"/><numFmt numFmtId="165" formatCode="0.000"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
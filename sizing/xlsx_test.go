@@ -0,0 +1,178 @@
+package sizing
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"testing"
+)
+
+type xlsxTestSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			T      string `xml:"t,attr"`
+			F      string `xml:"f"`
+			V      string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// xlsxTestCell is a cell of xlsxTestSheet
+type xlsxTestCell struct {
+	t, f, v, inline string
+}
+
+// readXLSX returns contents of zip parts, failing if any of them is not well
+// formed XML
+func readXLSX(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = data
+	}
+	return parts
+}
+
+// xlsxCells returns cells of sheet keyed by reference, i.e. "F2"
+func xlsxCells(t *testing.T, data []byte) map[string]xlsxTestCell {
+	t.Helper()
+	var s xlsxTestSheet
+	if err := xml.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	cells := make(map[string]xlsxTestCell)
+	for _, row := range s.Rows {
+		for _, c := range row.Cells {
+			cells[c.R] = xlsxTestCell{t: c.T, f: c.F, v: c.V, inline: c.Inline}
+		}
+	}
+	return cells
+}
+
+func TestWriteXLSX(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteXLSX(buf, NewReport(testGroupRows(), "team"), testOfferings); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels",
+		"xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("no %s part", name)
+		}
+	}
+
+	sheets := make([]map[string]xlsxTestCell, 3)
+	for i, name := range []string{"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"} {
+		sheets[i] = xlsxCells(t, parts[name])
+		for ref, c := range sheets[i] {
+			switch c.t {
+			case "inlineStr", "b":
+			case "":
+				if _, err := strconv.ParseFloat(c.v, 64); err != nil {
+					t.Errorf("%s %s: numeric cell has value %q", name, ref, c.v)
+				}
+			default:
+				t.Errorf("%s %s: got cell type %q", name, ref, c.t)
+			}
+		}
+	}
+	report, params, offerings := sheets[0], sheets[1], sheets[2]
+
+	if c := params["B2"]; c.v != strconv.Itoa(HoursPerMonth) || params["A2"].inline != "Hours per month" {
+		t.Errorf("got hours per month cell %+v", c)
+	}
+	if c := report["X1"]; c.inline != "Nodes" {
+		t.Errorf("got X1 %+v, want Nodes header", c)
+	}
+	// rows: header, a-1 with current node, subtotal a, b-1, b-2, subtotal b,
+	// none, subtotal (none), total
+	for ref, want := range map[string]string{
+		"F2": "E2*Parameters!$B$2*X2",
+		"K2": "J2*Parameters!$B$2*X2",
+		"Q2": "P2*Parameters!$B$2*X2",
+		"R2": "Q2-F2",
+		"S2": "Q2-K2",
+		"F3": "SUBTOTAL(9,F2:F2)",
+		"Q3": "SUBTOTAL(9,Q2:Q2)",
+		"F5": "E5*Parameters!$B$2*X5",
+		"F6": "SUBTOTAL(9,F4:F5)",
+		"K6": "SUBTOTAL(9,K4:K5)",
+		"S6": "SUBTOTAL(9,S4:S5)",
+		"K8": "SUBTOTAL(9,K7:K7)",
+		"F9": "SUBTOTAL(9,F2:F8)",
+		"K9": "SUBTOTAL(9,K2:K8)",
+		"R9": "SUBTOTAL(9,R2:R8)",
+	} {
+		if got := report[ref].f; got != want {
+			t.Errorf("got %s formula %q, want %q", ref, got, want)
+		}
+	}
+	for ref, c := range map[string]xlsxTestCell{
+		"A2": {t: "inlineStr", inline: "a-1:6379"},
+		"A3": {t: "inlineStr", inline: "Subtotal team=a"},
+		"A9": {t: "inlineStr", inline: "Total"},
+		"E2": {v: "0.216"},
+		"O2": {t: "inlineStr", inline: "cache.r5.xlarge"},
+		"W5": {t: "inlineStr", inline: "env=prod,team=b"},
+		"X2": {v: "2"},
+		"X4": {v: "1"},
+	} {
+		if got := report[ref]; got.t != c.t || got.v != c.v || got.inline != c.inline {
+			t.Errorf("got %s %+v, want %+v", ref, got, c)
+		}
+	}
+	// cached values of formulas match report
+	for ref, want := range map[string]float64{
+		"F2": 0.216 * HoursPerMonth * 2,
+		"R2": (0.431 - 0.216) * HoursPerMonth * 2,
+		"F9": (0.216*4 + 0.431) * HoursPerMonth,
+		"K9": (0.216*3 + 0.431*2) * HoursPerMonth,
+	} {
+		got, _ := strconv.ParseFloat(report[ref].v, 64)
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("got %s value %g, want %g", ref, got, want)
+		}
+	}
+	if _, ok := report["A10"]; ok {
+		t.Error("got rows after total")
+	}
+
+	for i, o := range testOfferings {
+		n := strconv.Itoa(i + 2)
+		if got := offerings["A"+n].inline; got != o.InstanceType {
+			t.Errorf("got A%s %q, want %q", n, got, o.InstanceType)
+		}
+		if got, want := offerings["E"+n].f, "D"+n+"*Parameters!$B$2"; got != want {
+			t.Errorf("got E%s formula %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/Doist/elasticache-redis-cost/sizing"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/pricing"
+)
+
+// snapshotMain saves prices of all node types of regions to a pricing
+// snapshot file, which can be used with -pricing-snapshot flag
+func snapshotMain(argv []string) error {
+	var regions stringsFlag
+	var output, bulkPrices string
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.Var(&regions, "region", "AWS `region` to save prices of, can be repeated (default us-east-1)")
+	fs.StringVar(&bulkPrices, "bulk-prices", "",
+		"`source` of AWS bulk price list offer file to use prices from instead of AWS Price List API,\n"+
+			"either URL or path, {region} is replaced with region code; \"aws\" for the public AWS offer file")
+	fs.StringVar(&output, "o", "", "`path` to save snapshot to, snapshot is written to stdout if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s snapshot:\n", progName())
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+	if len(regions) == 0 {
+		regions = stringsFlag{"us-east-1"}
+	}
+	engines := make([]string, 0, len(sizing.Engines))
+	for engine := range sizing.Engines {
+		engines = append(engines, engine)
+	}
+	sort.Strings(engines)
+	var queries []sizing.OfferingsQuery
+	for _, name := range regions {
+		region, ok := endpoints.AwsPartition().Regions()[name]
+		if !ok {
+			return fmt.Errorf("unsupported region %q", name)
+		}
+		for _, engine := range engines {
+			queries = append(queries, sizing.OfferingsQuery{
+				Engine:        engine,
+				Location:      region.Description(),
+				AnyFamily:     true,
+				AnyGeneration: true,
+			})
+		}
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	prices := sizing.NewAPIProvider(pricing.New(sess))
+	if bulkPrices != "" {
+		prices = sizing.NewBulkProvider(bulkPricesSource(bulkPrices), nil)
+	}
+	snap, err := sizing.TakeSnapshot(context.Background(), prices, queries...)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return snap.Write(os.Stdout)
+	}
+	buf := new(bytes.Buffer)
+	if err := snap.Write(buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, buf.Bytes(), 0666)
+}